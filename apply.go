@@ -0,0 +1,345 @@
+package diff
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type applyOp int
+
+const (
+	opReplace applyOp = iota
+	opRemove
+	opAdd
+	// opSkip rows like DiffOfSliceLength only describe the change
+	opSkip
+)
+
+func opOf(d *D) applyOp {
+	switch {
+	case isLengthRow(d):
+		return opSkip
+	case d.Reason == DiffOfLeftElemRemoved:
+		return opRemove
+	case d.Reason == DiffOfRightElemAdded:
+		return opAdd
+	case d.Reason == DiffOfRightNoValue && !d.RightV.IsValid():
+		return opRemove
+	}
+	return opReplace
+}
+
+// isLengthRow rows like DiffOfSliceLength carry int lengths at the path of the container
+func isLengthRow(d *D) bool {
+	return d.Reason == DiffOfSliceLength || d.Reason == DiffOfMapLength
+}
+
+// Apply patch to target which is a pointer, so that left becomes right. Slice elements are replaced first,
+// then removed by left indexes and added by right indexes. Target is not changed if any row can't be applied.
+// Moves of elements matched by identity are not in patch, they keep the order of target, patches of WithSliceOrdered keep the order of right.
+// Untyped documents like map[string]interface{} are supported, intermediate nodes are created, arrays grow as needed
+// and values are converted to the form of encoding/json. Keys are case sensitive, fields of typed patches are named by json tags.
+func (p *Patch) Apply(target interface{}) error {
+	tv := reflect.ValueOf(target)
+	if !tv.IsValid() || tv.Kind() != reflect.Ptr || tv.IsNil() {
+		return fmt.Errorf("diff: apply target should be a non-nil pointer")
+	}
+	if err := checkLengthRows(p.List); err != nil {
+		return err
+	}
+	cp := cloneValue(tv.Elem())
+	if err := applyRows(cp, p.List, p.rootType); err != nil {
+		return err
+	}
+	tv.Elem().Set(cp)
+	return nil
+}
+
+// checkLengthRows length rows are skipped by apply, so rows of elements or the container should change the length
+func checkLengthRows(rows []*D) error {
+	for _, d := range rows {
+		if !isLengthRow(d) {
+			continue
+		}
+		var covered bool
+		for _, r := range rows {
+			if !isLengthRow(r) && (r.Path == d.Path || isSubPath(d.Path, r.Path) || isSubPath(r.Path, d.Path)) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			return fmt.Errorf("diff: can't apply %s: no element rows of the length row", d.Path)
+		}
+	}
+	return nil
+}
+
+// applyRows apply rows to settable v in the order of replace, remove and add, src is the type paths of rows come from
+func applyRows(v reflect.Value, rows []*D, src reflect.Type) error {
+	var removed, added []*D
+	for _, d := range rows {
+		switch opOf(d) {
+		case opRemove:
+			removed = append(removed, d)
+		case opAdd:
+			added = append(added, d)
+		case opSkip:
+		default:
+			if err := applyPath(v, d.Path, opReplace, d.RightV, src); err != nil {
+				return err
+			}
+		}
+	}
+	sort.SliceStable(removed, func(i, j int) bool { return comparePath(removed[i].Path, removed[j].Path) > 0 })
+	for _, d := range removed {
+		if err := applyPath(v, d.Path, opRemove, reflect.Value{}, src); err != nil {
+			return err
+		}
+	}
+	sort.SliceStable(added, func(i, j int) bool { return comparePath(added[i].Path, added[j].Path) < 0 })
+	for _, d := range added {
+		if err := applyPath(v, d.Path, opAdd, d.RightV, src); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cloneValue deep copy v to a settable value
+func cloneValue(v reflect.Value) reflect.Value {
+	cl := cloner{config: &config{}}
+	nv := reflect.New(v.Type()).Elem()
+	nv.Set(cl.clone(nil, v))
+	return nv
+}
+
+// applyPath apply op of val at path in settable v, nil pointers and maps on the path are created.
+// src is the declared type of v in the type path comes from, fields of it are named by json tags in untyped maps
+func applyPath(v reflect.Value, path string, op applyOp, val reflect.Value, src reflect.Type) error {
+	if path == "" || path == _ROOT {
+		if op == opRemove {
+			v.Set(reflect.Zero(v.Type()))
+			return nil
+		}
+		return setValue(v, val, path)
+	}
+	token, rest := nextPathToken(path)
+	if token == _SPLITTOR {
+		return applyPath(v, rest, op, val, src)
+	}
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			if op == opRemove {
+				return nil
+			}
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+	if v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			if op == opRemove {
+				return nil
+			}
+			if v.NumMethod() > 0 {
+				return fmt.Errorf("diff: can't apply %s: nil interface", path)
+			}
+			// intermediate node of untyped document
+			if isIndexToken(token) {
+				v.Set(reflect.ValueOf([]interface{}{}))
+			} else {
+				v.Set(reflect.ValueOf(map[string]interface{}{}))
+			}
+		}
+		ev := reflect.New(v.Elem().Type()).Elem()
+		ev.Set(v.Elem())
+		if err := applyPath(ev, path, op, val, src); err != nil {
+			return err
+		}
+		v.Set(ev)
+		return nil
+	}
+	switch {
+	case isIndexToken(token) && isListKind(v.Kind()):
+		i, _ := strconv.Atoi(token[1 : len(token)-1])
+		if isUntyped(v.Type().Elem()) {
+			val = untypedValue(val)
+			if v.Kind() == reflect.Slice && i >= v.Len() && op != opRemove && (rest != "" || op == opReplace) {
+				v.Set(reflect.AppendSlice(v, reflect.MakeSlice(v.Type(), i+1-v.Len(), i+1-v.Len())))
+			}
+		}
+		if rest == "" {
+			return applyIndex(v, i, op, val, path)
+		}
+		if i >= v.Len() {
+			return fmt.Errorf("diff: can't apply %s: index out of range", path)
+		}
+		return applyPath(v.Index(i), rest, op, val, elemOfSource(src, token))
+	case strings.HasPrefix(token, _SPLITTOR) && v.Kind() == reflect.Struct:
+		f := v.FieldByName(token[1:])
+		if !f.IsValid() || !f.CanSet() {
+			return fmt.Errorf("diff: can't apply %s: no field %s", path, token[1:])
+		}
+		if rest == "" && op == opRemove {
+			f.Set(reflect.Zero(f.Type()))
+			return nil
+		}
+		return applyPath(f, rest, op, val, elemOfSource(src, token))
+	case strings.HasPrefix(token, _SPLITTOR) && v.Kind() == reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return fmt.Errorf("diff: can't apply %s: map key should be string", path)
+		}
+		name := token[1:]
+		if isUntyped(v.Type().Elem()) {
+			val = untypedValue(val)
+			if f, ok := fieldOfSource(src, name); ok {
+				if f.Anonymous && f.Tag.Get("json") == "" && indirectType(f.Type).Kind() == reflect.Struct {
+					// fields of embedded struct are flattened like encoding/json
+					return applyPath(v, rest, op, val, f.Type)
+				}
+				name, _ = fieldKey(f, "json")
+			}
+		}
+		key := reflect.ValueOf(name).Convert(v.Type().Key())
+		if v.IsNil() {
+			if op == opRemove {
+				return nil
+			}
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+		if rest == "" && op == opRemove {
+			v.SetMapIndex(key, reflect.Value{})
+			return nil
+		}
+		ev := reflect.New(v.Type().Elem()).Elem()
+		if old := v.MapIndex(key); old.IsValid() {
+			ev.Set(old)
+		}
+		if err := applyPath(ev, rest, op, val, elemOfSource(src, token)); err != nil {
+			return err
+		}
+		v.SetMapIndex(key, ev)
+		return nil
+	}
+	return fmt.Errorf("diff: can't apply %s: no path %s in %v", path, token, v.Type())
+}
+
+// fieldOfSource is the struct field of src named by path step name
+func fieldOfSource(src reflect.Type, name string) (reflect.StructField, bool) {
+	if src == nil || indirectType(src).Kind() != reflect.Struct {
+		return reflect.StructField{}, false
+	}
+	return indirectType(src).FieldByName(name)
+}
+
+// elemOfSource is the declared type of path step token in src, nil if unknown
+func elemOfSource(src reflect.Type, token string) reflect.Type {
+	if src == nil {
+		return nil
+	}
+	switch t := indirectType(src); {
+	case isIndexToken(token) && isListKind(t.Kind()), t.Kind() == reflect.Map:
+		return t.Elem()
+	case t.Kind() == reflect.Struct:
+		if f, ok := t.FieldByName(token[1:]); ok {
+			return f.Type
+		}
+	}
+	return nil
+}
+
+func applyIndex(v reflect.Value, i int, op applyOp, val reflect.Value, path string) error {
+	switch {
+	case op == opAdd && v.Kind() == reflect.Slice:
+		if i > v.Len() {
+			return fmt.Errorf("diff: can't apply %s: index out of range", path)
+		}
+		nv := reflect.MakeSlice(v.Type(), v.Len()+1, v.Len()+1)
+		reflect.Copy(nv, v.Slice(0, i))
+		reflect.Copy(nv.Slice(i+1, nv.Len()), v.Slice(i, v.Len()))
+		if err := setValue(nv.Index(i), val, path); err != nil {
+			return err
+		}
+		v.Set(nv)
+		return nil
+	case i >= v.Len():
+		return fmt.Errorf("diff: can't apply %s: index out of range", path)
+	case op == opRemove && v.Kind() == reflect.Slice:
+		nv := reflect.MakeSlice(v.Type(), 0, v.Len()-1)
+		nv = reflect.AppendSlice(nv, v.Slice(0, i))
+		v.Set(reflect.AppendSlice(nv, v.Slice(i+1, v.Len())))
+		return nil
+	case op == opRemove:
+		v.Index(i).Set(reflect.Zero(v.Type().Elem()))
+		return nil
+	}
+	return setValue(v.Index(i), val, path)
+}
+
+// setValue set a copy of val to v, pointers wrapped by differ and numbers of other types are fitted
+func setValue(v reflect.Value, val reflect.Value, path string) error {
+	fv, ok := fitValue(val, v.Type())
+	if !ok {
+		return fmt.Errorf("diff: can't apply %s: %v is not assignable to %v", path, val.Type(), v.Type())
+	}
+	v.Set(cloneValue(fv))
+	return nil
+}
+
+func fitValue(v reflect.Value, t reflect.Type) (reflect.Value, bool) {
+	if !v.IsValid() {
+		return reflect.Zero(t), true
+	}
+	vt := v.Type()
+	switch {
+	case vt.AssignableTo(t):
+		return v, true
+	case v.Kind() == reflect.Interface || (v.Kind() == reflect.Ptr && t.Kind() != reflect.Ptr):
+		if v.IsNil() {
+			return reflect.Zero(t), true
+		}
+		return fitValue(v.Elem(), t)
+	case t.Kind() == reflect.Ptr:
+		ev, ok := fitValue(v, t.Elem())
+		if !ok {
+			return v, false
+		}
+		p := reflect.New(t.Elem())
+		p.Elem().Set(ev)
+		return p, true
+	case isNumberKind(vt.Kind()) && isNumberKind(t.Kind()), vt.Kind() == reflect.String && t.Kind() == reflect.String:
+		return v.Convert(t), true
+	}
+	return v, false
+}
+
+// isUntyped is interface{}, the element type of untyped documents
+func isUntyped(t reflect.Type) bool {
+	return t.Kind() == reflect.Interface && t.NumMethod() == 0
+}
+
+// untypedValue convert typed value to the form of encoding/json, so untyped documents keep their shape
+func untypedValue(v reflect.Value) reflect.Value {
+	v = indirectValue(v)
+	if !v.IsValid() || !v.CanInterface() {
+		return v
+	}
+	switch v.Interface().(type) {
+	case string, bool, float64, map[string]interface{}, []interface{}:
+		return v
+	}
+	data, err := json.Marshal(v.Interface())
+	if err != nil {
+		return v
+	}
+	var res interface{}
+	if err = json.Unmarshal(data, &res); err != nil {
+		return v
+	}
+	return reflect.ValueOf(&res).Elem()
+}
@@ -0,0 +1,127 @@
+package diff
+
+import (
+	"reflect"
+)
+
+// WithSnapshot deep copy values of D when the difference is found, so the patch is not changed by later mutation of inputs
+func WithSnapshot(snapshot bool) Option {
+	return func(c *config) {
+		c.snapshot = snapshot
+	}
+}
+
+// SetSnapshot deep copy values of D when the difference is found
+func (df *Differ) SetSnapshot(snapshot bool) {
+	df.update(func(c *config) error {
+		c.snapshot = snapshot
+		return nil
+	})
+}
+
+// Clone deep copy v, the paths omitted by df are left zero, nil df means no path is omitted.
+// Unexported fields are copied shallowly.
+func Clone[T any](df *Differ, v T) T {
+	if df == nil {
+		df = defaultDiffer
+	}
+	rv := reflect.ValueOf(&v).Elem()
+	cl := cloner{config: df.load()}
+	rv.Set(cl.clone(make([]pathStep, 0, _STEPS_CAP), rv))
+	return v
+}
+
+type clonedKey struct {
+	p uintptr
+	t reflect.Type
+}
+
+// cloner deep copy values by the traversal of differ, shared pointers and cycles are kept
+type cloner struct {
+	*config
+	cloned map[clonedKey]reflect.Value
+}
+
+func (cl *cloner) clone(steps []pathStep, v reflect.Value) reflect.Value {
+	if !v.IsValid() {
+		return v
+	}
+	if len(steps) > 0 && cl.hasOmit() && cl.isOmit(buildPath(steps)) {
+		return reflect.Zero(v.Type())
+	}
+	t := v.Type()
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+		key := clonedKey{p: v.Pointer(), t: t}
+		if nv, ok := cl.cloned[key]; ok {
+			return nv
+		}
+		if cl.cloned == nil {
+			cl.cloned = make(map[clonedKey]reflect.Value)
+		}
+		nv := reflect.New(t.Elem())
+		cl.cloned[key] = nv
+		nv.Elem().Set(cl.clone(steps, v.Elem()))
+		return nv
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		nv := reflect.New(t).Elem()
+		nv.Set(cl.clone(steps, v.Elem()))
+		return nv
+	case reflect.Struct:
+		nv := reflect.New(t).Elem()
+		nv.Set(v)
+		for i := 0; i < t.NumField(); i++ {
+			ft := t.Field(i)
+			if !isExported(ft.Name) {
+				continue
+			}
+			nv.Field(i).Set(cl.clone(appendPath(steps, fieldStep(ft.Name, ft.Type)), v.Field(i)))
+		}
+		return nv
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		nv := reflect.MakeSlice(t, v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			nv.Index(i).Set(cl.clone(appendPath(steps, indexStep(i, t.Elem())), v.Index(i)))
+		}
+		return nv
+	case reflect.Array:
+		nv := reflect.New(t).Elem()
+		for i := 0; i < v.Len(); i++ {
+			nv.Index(i).Set(cl.clone(appendPath(steps, indexStep(i, t.Elem())), v.Index(i)))
+		}
+		return nv
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		nv := reflect.MakeMapWithSize(t, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			s := appendPath(steps, fieldStep(iter.Key().String(), t.Elem()))
+			if cl.hasOmit() && cl.isOmit(buildPath(s)) {
+				continue
+			}
+			nv.SetMapIndex(iter.Key(), cl.clone(s, iter.Value()))
+		}
+		return nv
+	}
+	return v
+}
+
+// snapshotOf deep copy value of D at steps
+func (df *differ) snapshotOf(steps []pathStep, v reflect.Value) reflect.Value {
+	if !v.IsValid() || !v.CanInterface() {
+		return v
+	}
+	cl := cloner{config: df.config}
+	return cl.clone(steps, v)
+}
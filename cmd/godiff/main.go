@@ -0,0 +1,418 @@
+// Command godiff compares two JSON (or NDJSON) files with the same semantics as diff.Differ.
+//
+// Usage:
+//
+//	godiff [flags] left.json right.json
+//
+// The exit code is 0 when both files are equal, 1 when they differ and 2 on error.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/qjpcpu/diff"
+)
+
+const (
+	exitEqual = 0
+	exitDiff  = 1
+	exitError = 2
+)
+
+const (
+	formatReadable  = "readable"
+	formatJSONPatch = "jsonpatch"
+	formatColor     = "color"
+)
+
+const (
+	colorReset  = "\033[0m"
+	colorRed    = "\033[31m"
+	colorGreen  = "\033[32m"
+	colorYellow = "\033[33m"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// listFlag collects repeatable and comma separated flag values
+type listFlag []string
+
+func (l *listFlag) String() string { return strings.Join(*l, ",") }
+
+func (l *listFlag) Set(v string) error {
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			*l = append(*l, s)
+		}
+	}
+	return nil
+}
+
+type options struct {
+	omit     listFlag
+	idFields listFlag
+	ordered  bool
+	floatTol float64
+	format   string
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	var opts options
+	fs := flag.NewFlagSet("godiff", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Var(&opts.omit, "omit", "path to skip, same as Differ.OmitPath, e.g. .meta.* or updated_at (repeatable)")
+	fs.Var(&opts.idFields, "id-field", "identity field of slice elements as path:field, e.g. items:sku or :sku for the root array (repeatable)")
+	fs.BoolVar(&opts.ordered, "ordered", false, "compare arrays by position instead of aligning elements by identity")
+	fs.Float64Var(&opts.floatTol, "float-tol", 0, "numbers whose difference is within the tolerance are equal")
+	fs.StringVar(&opts.format, "format", formatReadable, "output format: readable, jsonpatch or color")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: godiff [flags] left.json right.json")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return exitError
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return exitError
+	}
+	df, err := buildDiffer(opts)
+	if err != nil {
+		fmt.Fprintln(stderr, "godiff:", err)
+		return exitError
+	}
+	left, err := readDocument(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintln(stderr, "godiff:", err)
+		return exitError
+	}
+	right, err := readDocument(fs.Arg(1))
+	if err != nil {
+		fmt.Fprintln(stderr, "godiff:", err)
+		return exitError
+	}
+	patch := df.MakePatch(left, right)
+	if err = writePatch(stdout, opts.format, patch, left, right); err != nil {
+		fmt.Fprintln(stderr, "godiff:", err)
+		return exitError
+	}
+	if patch.IsEmpty() {
+		return exitEqual
+	}
+	return exitDiff
+}
+
+func buildDiffer(opts options) (*diff.Differ, error) {
+	switch opts.format {
+	case formatReadable, formatJSONPatch, formatColor:
+	default:
+		return nil, fmt.Errorf("unknown format %q", opts.format)
+	}
+	df := diff.New()
+	df.OmitPath(opts.omit...)
+	df.SetSliceOrdered(opts.ordered)
+	if opts.floatTol > 0 {
+		tol := opts.floatTol
+		if err := df.RegistCompareKindFunc(func(l, r float64) bool {
+			return math.Abs(l-r) <= tol
+		}); err != nil {
+			return nil, err
+		}
+	}
+	for _, idField := range opts.idFields {
+		i := strings.LastIndex(idField, ":")
+		if i < 0 || i == len(idField)-1 {
+			return nil, fmt.Errorf("bad id-field %q, should be path:field", idField)
+		}
+		path, field := idField[:i], idField[i+1:]
+		switch path {
+		case "", ".", "[*]", ".[*]":
+			// the root array, its path is empty at runtime
+			path = ""
+		default:
+			if !strings.HasPrefix(path, ".") {
+				path = "." + path
+			}
+		}
+		if err := df.RegistPathIDFunc(path, idOfField(field)); err != nil {
+			return nil, err
+		}
+	}
+	return df, nil
+}
+
+func idOfField(field string) func(interface{}) string {
+	return func(v interface{}) string {
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return fmt.Sprint(v)
+		}
+		id, ok := obj[field]
+		if !ok {
+			return hashOf(v)
+		}
+		return fmt.Sprint(id)
+	}
+}
+
+// hashOf identify elements without the id field by content, so they don't collide under one identity
+func hashOf(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
+
+// readDocument decodes a JSON file, NDJSON files (or files with several top level values) are decoded as an array
+func readDocument(file string) (interface{}, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var docs []interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	for {
+		var doc interface{}
+		if err = dec.Decode(&doc); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("%s: %v", file, err)
+		}
+		docs = append(docs, doc)
+	}
+	switch ext := strings.ToLower(filepath.Ext(file)); {
+	case ext == ".ndjson" || ext == ".jsonl":
+		if docs == nil {
+			docs = []interface{}{}
+		}
+		return docs, nil
+	case len(docs) == 0:
+		return nil, fmt.Errorf("%s: no json value found", file)
+	case len(docs) == 1:
+		return docs[0], nil
+	}
+	return docs, nil
+}
+
+func writePatch(w io.Writer, format string, patch diff.Patch, left, right interface{}) error {
+	switch format {
+	case formatJSONPatch:
+		return writeJSONPatch(w, patch, left, right)
+	case formatColor:
+		return writeColor(w, patch)
+	}
+	_, err := io.WriteString(w, patch.Readable())
+	return err
+}
+
+// operation of RFC 6902 JSON Patch
+type operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value,omitempty"`
+
+	index int
+}
+
+// toJSONPatch replaces first, then removes array elements from the tail, and adds at last.
+// The result is exact with --ordered, identity aligned arrays may be reordered.
+func toJSONPatch(patch diff.Patch, left, right interface{}) ([]operation, error) {
+	var replaces, removes, adds []operation
+	for _, d := range patch.List {
+		ptr, idx, err := jsonPointer(d.Path, left, right)
+		if err != nil {
+			return nil, err
+		}
+		value, err := rawValue(d.RightV)
+		if err != nil {
+			return nil, err
+		}
+		op := operation{Path: ptr, index: idx}
+		switch d.Reason {
+		case diff.DiffOfValue, diff.DiffOfType:
+			op.Op, op.Value = "replace", value
+			replaces = append(replaces, op)
+		case diff.DiffOfLeftNoValue:
+			if d.LeftV.IsValid() {
+				op.Op, op.Value = "replace", value
+				replaces = append(replaces, op)
+			} else {
+				op.Op, op.Value = "add", value
+				adds = append(adds, op)
+			}
+		case diff.DiffOfRightElemAdded:
+			op.Op, op.Value = "add", value
+			adds = append(adds, op)
+		case diff.DiffOfRightNoValue:
+			if d.RightV.IsValid() {
+				op.Op, op.Value = "replace", value
+				replaces = append(replaces, op)
+			} else {
+				op.Op = "remove"
+				removes = append(removes, op)
+			}
+		case diff.DiffOfLeftElemRemoved:
+			op.Op = "remove"
+			removes = append(removes, op)
+		default:
+			return nil, fmt.Errorf("%s: unsupported reason %s", d.Path, d.Reason)
+		}
+	}
+	sort.SliceStable(removes, func(i, j int) bool { return removes[i].index > removes[j].index })
+	sort.SliceStable(adds, func(i, j int) bool { return adds[i].index < adds[j].index })
+	return append(append(replaces, removes...), adds...), nil
+}
+
+func writeJSONPatch(w io.Writer, patch diff.Patch, left, right interface{}) error {
+	ops, err := toJSONPatch(patch, left, right)
+	if err != nil {
+		return err
+	}
+	if ops == nil {
+		ops = []operation{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(ops)
+}
+
+// jsonPointer convert path like .a.b[1] to /a/b/1, idx is the trailing array index or -1.
+// Keys in path are not escaped, keys with dots or brackets are resolved by the objects of docs.
+func jsonPointer(path string, docs ...interface{}) (ptr string, idx int, err error) {
+	var tokens []string
+	for rest := path; rest != ""; {
+		var token string
+		if token, rest = nextPathToken(rest); token != "." {
+			tokens = append(tokens, token)
+		}
+	}
+	var b strings.Builder
+	idx = -1
+	for len(tokens) > 0 {
+		objects := objectsOf(docs)
+		if strings.HasPrefix(tokens[0], "[") && len(objects) == 0 {
+			i, e := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(tokens[0], "["), "]"))
+			if e != nil || !strings.HasSuffix(tokens[0], "]") {
+				return "", -1, fmt.Errorf("bad path %s", path)
+			}
+			b.WriteString("/" + strconv.Itoa(i))
+			idx, tokens, docs = i, tokens[1:], elementsOf(docs, i)
+			continue
+		}
+		// the longest key of objects made by the following tokens
+		n := 1
+		for j := len(tokens); j > 1; j-- {
+			if hasKey(objects, keyOfTokens(tokens[:j])) {
+				n = j
+				break
+			}
+		}
+		key := keyOfTokens(tokens[:n])
+		b.WriteString("/" + strings.NewReplacer("~", "~0", "/", "~1").Replace(key))
+		idx, tokens, docs = -1, tokens[n:], valuesOf(objects, key)
+	}
+	return b.String(), idx, nil
+}
+
+// nextPathToken split path like .a[1] to .a and [1]
+func nextPathToken(p string) (token, rest string) {
+	end := strings.IndexAny(p[1:], ".[")
+	if end < 0 {
+		return p, ""
+	}
+	return p[:end+1], p[end+1:]
+}
+
+func keyOfTokens(tokens []string) string {
+	return strings.TrimPrefix(strings.Join(tokens, ""), ".")
+}
+
+func objectsOf(docs []interface{}) []map[string]interface{} {
+	var objects []map[string]interface{}
+	for _, doc := range docs {
+		if obj, ok := doc.(map[string]interface{}); ok {
+			objects = append(objects, obj)
+		}
+	}
+	return objects
+}
+
+func hasKey(objects []map[string]interface{}, key string) bool {
+	for _, obj := range objects {
+		if _, ok := obj[key]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func valuesOf(objects []map[string]interface{}, key string) []interface{} {
+	var values []interface{}
+	for _, obj := range objects {
+		if v, ok := obj[key]; ok {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+func elementsOf(docs []interface{}, i int) []interface{} {
+	var elems []interface{}
+	for _, doc := range docs {
+		if arr, ok := doc.([]interface{}); ok && i < len(arr) {
+			elems = append(elems, arr[i])
+		}
+	}
+	return elems
+}
+
+func writeColor(w io.Writer, patch diff.Patch) error {
+	var b bytes.Buffer
+	for _, d := range patch.List {
+		switch d.Reason {
+		case diff.DiffOfLeftNoValue, diff.DiffOfRightElemAdded:
+			fmt.Fprintf(&b, "%s+ %s: %s%s\n", colorGreen, d.Path, marshal(d.RightV), colorReset)
+		case diff.DiffOfRightNoValue, diff.DiffOfLeftElemRemoved:
+			fmt.Fprintf(&b, "%s- %s: %s%s\n", colorRed, d.Path, marshal(d.LeftV), colorReset)
+		default:
+			fmt.Fprintf(&b, "%s~ %s%s\n", colorYellow, d.Path, colorReset)
+			fmt.Fprintf(&b, "  %s- %s%s\n", colorRed, marshal(d.LeftV), colorReset)
+			fmt.Fprintf(&b, "  %s+ %s%s\n", colorGreen, marshal(d.RightV), colorReset)
+		}
+	}
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+func valueOf(v reflect.Value) interface{} {
+	if !v.IsValid() {
+		return nil
+	}
+	return v.Interface()
+}
+
+func rawValue(v reflect.Value) (json.RawMessage, error) {
+	return json.Marshal(valueOf(v))
+}
+
+func marshal(v reflect.Value) string {
+	data, err := json.Marshal(valueOf(v))
+	if err != nil {
+		return "<" + err.Error() + ">"
+	}
+	return string(data)
+}
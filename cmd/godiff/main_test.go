@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFile(t *testing.T, dir, name, content string) string {
+	file := filepath.Join(dir, name)
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := os.MkdirTemp("", "godiff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestJSONPointer(t *testing.T) {
+	check := func(path, ptr string, idx int) {
+		p, i, err := jsonPointer(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p != ptr || i != idx {
+			t.Fatalf("pointer of %s should be %s(%d), but get %s(%d)", path, ptr, idx, p, i)
+		}
+	}
+	check(".", "", -1)
+	check(".a.b", "/a/b", -1)
+	check(".a[1].b", "/a/1/b", -1)
+	check(".a[1][2]", "/a/1/2", 2)
+	check(".[3]", "/3", 3)
+	check(".a/b.c~d", "/a~1b/c~0d", -1)
+
+	// keys with dots and brackets are resolved by documents
+	var left, right interface{}
+	json.Unmarshal([]byte(`{"a.b":{"c":1},"x[1]":[{"k~/":2}],"list":[0,{"y.z":3}]}`), &left)
+	json.Unmarshal([]byte(`{"a.b":{"c":2},"new.key":1}`), &right)
+	checkDocs := func(path, ptr string, idx int) {
+		t.Helper()
+		p, i, err := jsonPointer(path, left, right)
+		if err != nil || p != ptr || i != idx {
+			t.Fatalf("pointer of %s should be %s(%d), but get %s(%d) %v", path, ptr, idx, p, i, err)
+		}
+	}
+	checkDocs(".a.b.c", "/a.b/c", -1)
+	checkDocs(".x[1][0].k~/", "/x[1]/0/k~0~1", -1)
+	checkDocs(".list[1].y.z", "/list/1/y.z", -1)
+	checkDocs(".new.key", "/new.key", -1)
+	checkDocs(".list[1]", "/list/1", 1)
+}
+
+func TestRunExitCode(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	l := writeFile(t, dir, "l.json", `{"name":"a","price":1.0001,"meta":{"ts":1},"items":[{"sku":"a","n":1},{"sku":"b","n":2}]}`)
+	r := writeFile(t, dir, "r.json", `{"name":"a","price":1.0002,"meta":{"ts":2},"items":[{"sku":"b","n":2},{"sku":"a","n":1}]}`)
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{l, l}, &stdout, &stderr); code != exitEqual {
+		t.Fatal("should equal", code, stderr.String())
+	}
+	if code := run([]string{l, r}, &stdout, &stderr); code != exitDiff {
+		t.Fatal("should differ", code, stderr.String())
+	}
+	args := []string{"--omit=.meta.*", "--float-tol=0.001", "--id-field=items:sku", l, r}
+	if code := run(args, &stdout, &stderr); code != exitEqual {
+		t.Fatal("should equal", code, stdout.String())
+	}
+	if code := run([]string{"--format=xml", l, r}, &stdout, &stderr); code != exitError {
+		t.Fatal("should fail", code)
+	}
+	if code := run([]string{l}, &stdout, &stderr); code != exitError {
+		t.Fatal("should fail", code)
+	}
+}
+
+func TestRunJSONPatch(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	l := writeFile(t, dir, "l.ndjson", "{\"a\":1}\n{\"a\":2}\n{\"a\":3}\n")
+	r := writeFile(t, dir, "r.ndjson", "{\"a\":1}\n{\"a\":5}\n")
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"--ordered", "--format=jsonpatch", l, r}, &stdout, &stderr); code != exitDiff {
+		t.Fatal("should differ", code, stderr.String())
+	}
+	var ops []map[string]interface{}
+	if err := json.Unmarshal(stdout.Bytes(), &ops); err != nil {
+		t.Fatal(err)
+	}
+	if len(ops) != 2 {
+		t.Fatal("bad patch", stdout.String())
+	}
+	if ops[0]["op"] != "replace" || ops[0]["path"] != "/1/a" || ops[0]["value"] != float64(5) {
+		t.Fatal("bad replace", ops[0])
+	}
+	if ops[1]["op"] != "remove" || ops[1]["path"] != "/2" {
+		t.Fatal("bad remove", ops[1])
+	}
+}
+
+func TestRunColor(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	l := writeFile(t, dir, "l.json", `{"a":1,"b":null}`)
+	r := writeFile(t, dir, "r.json", `{"a":2,"c":true}`)
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"--format=color", l, r}, &stdout, &stderr); code != exitDiff {
+		t.Fatal("should differ", code, stderr.String())
+	}
+	out := stdout.String()
+	for _, s := range []string{"~ .a", "- 1", "+ 2", "- .b: null", "+ .c: true"} {
+		if !strings.Contains(out, s) {
+			t.Fatalf("output should contain %q:\n%s", s, out)
+		}
+	}
+}
+
+func TestRunRootIDField(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	l := writeFile(t, dir, "l.json", `[{"sku":"a","n":1},{"sku":"b","n":2}]`)
+	r := writeFile(t, dir, "r.json", `[{"sku":"b","n":3},{"sku":"a","n":1}]`)
+	for _, idField := range []string{":sku", ".:sku", "[*]:sku", ".[*]:sku"} {
+		var stdout, stderr bytes.Buffer
+		if code := run([]string{"--id-field=" + idField, l, r}, &stdout, &stderr); code != exitDiff {
+			t.Fatal("should differ", idField, code, stderr.String())
+		}
+		if out := stdout.String(); !strings.Contains(out, "Patch size: 1") || !strings.Contains(out, "[1].n") {
+			t.Fatal("root elements should be matched by sku", idField, out)
+		}
+	}
+
+	// elements without the id field are matched by content
+	l = writeFile(t, dir, "l2.json", `[{"n":1},{"n":2},{"sku":"a"}]`)
+	r = writeFile(t, dir, "r2.json", `[{"n":2},{"sku":"a"},{"n":1}]`)
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"--id-field=:sku", l, r}, &stdout, &stderr); code != exitEqual {
+		t.Fatal("should equal", code, stdout.String())
+	}
+}
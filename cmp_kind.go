@@ -78,19 +78,19 @@ func IDOfFloat64(f float64) string {
 }
 
 // IDOfAnything a is any non-pointer value
-func (df *differ) IDOfAnything(a interface{}) string {
+func (c *config) IDOfAnything(a interface{}) string {
 	vtype := reflect.TypeOf(a)
 	if vtype == nil {
 		return _ZERO
 	}
 	v := reflect.ValueOf(a)
-	if fn, ok := df.typeCache.Get(vtype); ok {
+	if fn, ok := c.typeCache.Get(vtype); ok {
 		out := fn.Call([]reflect.Value{v})
 		return out[0].String()
 	}
 	if vtype.Kind() == reflect.Struct {
 		if fn, ok := isStructWithIDField(vtype); ok {
-			df.typeCache.Set(vtype, fn)
+			c.typeCache.Set(vtype, fn)
 			out := fn.Call([]reflect.Value{v})
 			return out[0].String()
 		}
@@ -4,83 +4,119 @@ import (
 	"reflect"
 )
 
-func cmpMap(df *differ, steps []string, k, v reflect.Type, lv, rv reflect.Value) bool {
-	visitedKeys := make(map[interface{}]bool)
-	keys := lv.MapKeys()
-	for _, key := range keys {
-		visitedKeys[key.Interface()] = true
-		lvv, rvv := lv.MapIndex(key), rv.MapIndex(key)
-		df.setPathToType(buildPath(appendPath(steps, key.String())), lvv.Type())
-		if !rvv.IsValid() {
-			if !df.Callback(buildPath(appendPath(steps, key.String())), DiffOfRightNoValue, lvv, rvv) {
-				return false
-			}
-			continue
+func cmpMap(df *differ, steps []pathStep, k, v reflect.Type, lv, rv reflect.Value) bool {
+	if df.fn == nil {
+		return cmpMapEqual(df, steps, lv, rv)
+	}
+	var matched int
+	keys := sortMapKeys(lv.MapKeys())
+	if df.shouldParallel(len(keys)) {
+		if !parallelEach(df, steps, len(keys), func(child *differ, steps []pathStep, i int) bool {
+			return cmpMapEntry(child, steps, keys[i], lv.MapIndex(keys[i]), rv.MapIndex(keys[i]))
+		}) {
+			return false
 		}
-		if lvv.Type().Kind() == reflect.Ptr {
-			if lvv.IsNil() != rvv.IsNil() {
-				s := appendPath(steps, key.String())
-				if lvv.IsNil() && !rvv.IsNil() {
-					if !df.Callback(buildPath(s), DiffOfLeftNoValue, lvv, rvv) {
-						return false
-					}
-				} else if !lvv.IsNil() && rvv.IsNil() {
-					if !df.Callback(buildPath(s), DiffOfRightNoValue, lvv, rvv) {
-						return false
-					}
-				}
-				continue
+		for _, key := range keys {
+			if rv.MapIndex(key).IsValid() {
+				matched++
 			}
-			if !lvv.IsNil() {
-				if !cmpVal(df, appendPath(steps, key.String()), lvv.Type().Elem(), lvv.Elem(), rvv.Elem()) {
-					return false
-				}
+		}
+	} else {
+		for _, key := range keys {
+			rvv := rv.MapIndex(key)
+			if rvv.IsValid() {
+				matched++
 			}
-		} else {
-			if !cmpVal(df, appendPath(steps, key.String()), lvv.Type(), lvv, rvv) {
+			if !cmpMapEntry(df, steps, key, lv.MapIndex(key), rvv) {
 				return false
 			}
 		}
-
 	}
-	keys = rv.MapKeys()
-	for _, key := range keys {
-		if visitedKeys[key.Interface()] {
+	// the keys of right are all visited
+	if matched == rv.Len() {
+		return true
+	}
+	for _, key := range sortMapKeys(rv.MapKeys()) {
+		if lv.MapIndex(key).IsValid() {
 			continue
 		}
-		lvv, rvv := lv.MapIndex(key), rv.MapIndex(key)
-		df.setPathToType(buildPath(appendPath(steps, key.String())), rvv.Type())
-		if !lvv.IsValid() {
-			if !df.Callback(buildPath(appendPath(steps, key.String())), DiffOfLeftNoValue, lvv, rvv) {
-				return false
-			}
-			continue
+		rvv := rv.MapIndex(key)
+		if !df.Callback(appendPath(steps, fieldStep(key.String(), rvv.Type())), DiffOfLeftNoValue, reflect.Value{}, rvv) {
+			return false
+		}
+	}
+	return true
+}
+
+// cmpMapEqual check equality only, keys are visited in map order since no row is reported
+func cmpMapEqual(df *differ, steps []pathStep, lv, rv reflect.Value) bool {
+	var matched int
+	if df.shouldParallel(lv.Len()) {
+		keys := lv.MapKeys()
+		if !parallelEach(df, steps, len(keys), func(child *differ, steps []pathStep, i int) bool {
+			return cmpMapEntry(child, steps, keys[i], lv.MapIndex(keys[i]), rv.MapIndex(keys[i]))
+		}) {
+			return false
 		}
-		if lvv.Type().Kind() == reflect.Ptr {
-			if lvv.IsNil() != rvv.IsNil() {
-				s := appendPath(steps, key.String())
-				if lvv.IsNil() && !rvv.IsNil() {
-					if !df.Callback(buildPath(s), DiffOfLeftNoValue, lvv, rvv) {
-						return false
-					}
-				} else if !lvv.IsNil() && rvv.IsNil() {
-					if !df.Callback(buildPath(s), DiffOfRightNoValue, lvv, rvv) {
-						return false
-					}
-				}
-				continue
+		for _, key := range keys {
+			if rv.MapIndex(key).IsValid() {
+				matched++
 			}
-			if !lvv.IsNil() {
-				if !cmpVal(df, appendPath(steps, key.String()), lvv.Type().Elem(), lvv.Elem(), rvv.Elem()) {
-					return false
-				}
+		}
+	} else {
+		// key and value are reused since they are not kept without rows
+		key, lvv := reflect.New(lv.Type().Key()).Elem(), reflect.New(lv.Type().Elem()).Elem()
+		iter := lv.MapRange()
+		for iter.Next() {
+			key.SetIterKey(iter)
+			lvv.SetIterValue(iter)
+			rvv := rv.MapIndex(key)
+			if rvv.IsValid() {
+				matched++
 			}
-		} else {
-			if !cmpVal(df, appendPath(steps, key.String()), lvv.Type(), lvv, rvv) {
+			if !cmpMapEntry(df, steps, key, lvv, rvv) {
 				return false
 			}
 		}
-
+	}
+	if matched == rv.Len() {
+		return true
+	}
+	iter := rv.MapRange()
+	for iter.Next() {
+		key, rvv := iter.Key(), iter.Value()
+		if lv.MapIndex(key).IsValid() {
+			continue
+		}
+		if !df.Callback(appendPath(steps, fieldStep(key.String(), rvv.Type())), DiffOfLeftNoValue, reflect.Value{}, rvv) {
+			return false
+		}
 	}
 	return true
 }
+
+func cmpMapEntry(df *differ, steps []pathStep, key, lvv, rvv reflect.Value) bool {
+	s := appendPath(steps, fieldStep(key.String(), lvv.Type()))
+	if !rvv.IsValid() {
+		return df.Callback(s, DiffOfRightNoValue, lvv, rvv)
+	}
+	return cmpMapValue(df, s, lvv, rvv)
+}
+
+func cmpMapValue(df *differ, s []pathStep, lvv, rvv reflect.Value) bool {
+	if lvv.Type().Kind() == reflect.Ptr {
+		if lvv.IsNil() != rvv.IsNil() {
+			if lvv.IsNil() && !rvv.IsNil() {
+				return df.Callback(s, DiffOfLeftNoValue, lvv, rvv)
+			} else if !lvv.IsNil() && rvv.IsNil() {
+				return df.Callback(s, DiffOfRightNoValue, lvv, rvv)
+			}
+			return true
+		}
+		if !lvv.IsNil() {
+			return cmpVal(df, s, lvv.Type().Elem(), lvv.Elem(), rvv.Elem())
+		}
+		return true
+	}
+	return cmpVal(df, s, lvv.Type(), lvv, rvv)
+}
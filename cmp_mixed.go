@@ -0,0 +1,362 @@
+package diff
+
+import (
+	"encoding"
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+var (
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// canCmpMixed whether values of different types can be compared by structure, e.g. struct with map[string]interface{}
+func (c *config) canCmpMixed(lt, rt reflect.Type) bool {
+	lt, rt = indirectType(lt), indirectType(rt)
+	if lt == rt {
+		return c.autoDeref
+	}
+	// containers of mismatched pointer levels, e.g. []T with []*T
+	if c.autoDeref && isListKind(lt.Kind()) && isListKind(rt.Kind()) {
+		return lt.Elem() == rt.Elem() || c.canCmpMixed(lt.Elem(), rt.Elem())
+	}
+	if c.autoDeref && isStringMap(lt) && isStringMap(rt) {
+		return lt.Elem() == rt.Elem() || c.canCmpMixed(lt.Elem(), rt.Elem())
+	}
+	if lt.Kind() == reflect.Struct && rt.Kind() == reflect.Struct {
+		return c.structural
+	}
+	if lt.Kind() == reflect.Struct && isStringMap(rt) {
+		return true
+	}
+	return isStringMap(lt) && rt.Kind() == reflect.Struct
+}
+
+func indirectType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+func isStringMap(t reflect.Type) bool {
+	return t.Kind() == reflect.Map && t.Key().Kind() == reflect.String
+}
+
+func isSignedKind(k reflect.Kind) bool {
+	return reflect.Int <= k && k <= reflect.Int64
+}
+
+func isUnsignedKind(k reflect.Kind) bool {
+	return reflect.Uint <= k && k <= reflect.Uintptr
+}
+
+func isNumberKind(k reflect.Kind) bool {
+	return isSignedKind(k) || isUnsignedKind(k) || k == reflect.Float32 || k == reflect.Float64
+}
+
+func isListKind(k reflect.Kind) bool {
+	return k == reflect.Slice || k == reflect.Array
+}
+
+// indirectValue unwrap interfaces and pointers, nil is returned as invalid value
+func indirectValue(v reflect.Value) reflect.Value {
+	for v.IsValid() && (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+// jsonValue convert json/text marshaler to its untyped json form
+func jsonValue(v reflect.Value) (reflect.Value, bool) {
+	if !v.CanInterface() {
+		return v, false
+	}
+	if !v.Type().Implements(jsonMarshalerType) && !v.Type().Implements(textMarshalerType) {
+		return v, false
+	}
+	data, err := json.Marshal(v.Interface())
+	if err != nil {
+		return v, false
+	}
+	var res interface{}
+	if err = json.Unmarshal(data, &res); err != nil {
+		return v, false
+	}
+	return indirectValue(reflect.ValueOf(res)), true
+}
+
+// cmpMixed compare values which may be of different types, leaves are compared with kind coercion
+func cmpMixed(df *differ, steps []pathStep, lv, rv reflect.Value) bool {
+	lv, rv = indirectValue(lv), indirectValue(rv)
+	if !lv.IsValid() || !rv.IsValid() {
+		if !lv.IsValid() && rv.IsValid() {
+			return df.Callback(steps, DiffOfLeftNoValue, lv, rv)
+		} else if lv.IsValid() && !rv.IsValid() {
+			return df.Callback(steps, DiffOfRightNoValue, lv, rv)
+		}
+		return true
+	}
+	if lv.Type() == rv.Type() {
+		return cmpVal(df, steps, lv.Type(), lv, rv)
+	}
+	if !df.enter(steps) {
+		return false
+	}
+	if jv, ok := jsonValue(lv); ok {
+		return cmpMixed(df, steps, jv, rv)
+	}
+	if jv, ok := jsonValue(rv); ok {
+		return cmpMixed(df, steps, lv, jv)
+	}
+	lk, rk := lv.Kind(), rv.Kind()
+	switch {
+	case lk == reflect.Struct && rk == reflect.Struct && df.structural:
+		return cmpStructs(df, steps, lv, rv)
+	case lk == reflect.Struct && isStringMap(rv.Type()):
+		return cmpStructMap(df, steps, lv, rv, true)
+	case isStringMap(lv.Type()) && rk == reflect.Struct:
+		return cmpStructMap(df, steps, rv, lv, false)
+	case isStringMap(lv.Type()) && isStringMap(rv.Type()):
+		return cmpMapMixed(df, steps, lv, rv)
+	case isListKind(lk) && isListKind(rk):
+		return cmpSliceMixed(df, steps, lv, rv)
+	case isSignedKind(lk) && isSignedKind(rk):
+		return df.cmpByKind(steps, reflect.Int64, lv, rv)
+	case isUnsignedKind(lk) && isUnsignedKind(rk):
+		return df.cmpByKind(steps, reflect.Uint64, lv, rv)
+	case isNumberKind(lk) && isNumberKind(rk):
+		return df.cmpByKind(steps, reflect.Float64, lv, rv)
+	case lk == reflect.String && rk == reflect.String:
+		return df.cmpByKind(steps, reflect.String, lv, rv)
+	case lk == reflect.Bool && rk == reflect.Bool:
+		return df.cmpByKind(steps, reflect.Bool, lv, rv)
+	}
+	return df.Callback(steps, DiffOfType, lv, rv)
+}
+
+// fieldKey is the key of struct field by tag, fallback to field name
+func fieldKey(ft reflect.StructField, tag string) (key string, skip bool) {
+	if tag == "" {
+		return ft.Name, false
+	}
+	tv := ft.Tag.Get(tag)
+	if tv == "-" {
+		return "", true
+	}
+	if name := strings.Split(tv, ",")[0]; name != "" {
+		return name, false
+	}
+	return ft.Name, false
+}
+
+type structField struct {
+	key   string
+	steps []pathStep
+	v     reflect.Value
+	// omitEmpty the field is tagged omitempty
+	omitEmpty bool
+}
+
+// collectFields list exported fields of struct, embedded structs without tag are flattened like encoding/json
+func collectFields(v reflect.Value, tag string, steps []pathStep, fields []structField) []structField {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		ft := t.Field(i)
+		if !isExported(ft.Name) {
+			continue
+		}
+		key, skip := fieldKey(ft, tag)
+		if skip {
+			continue
+		}
+		s := append(append([]pathStep{}, steps...), fieldStep(ft.Name, ft.Type))
+		if ft.Anonymous && (tag == "" || ft.Tag.Get(tag) == "") && indirectType(ft.Type).Kind() == reflect.Struct {
+			if fv := indirectValue(v.Field(i)); fv.IsValid() {
+				fields = collectFields(fv, tag, s, fields)
+			}
+			continue
+		}
+		omitEmpty := tag != "" && strings.Contains(ft.Tag.Get(tag), ",omitempty")
+		fields = append(fields, structField{key: key, steps: s, v: v.Field(i), omitEmpty: omitEmpty})
+	}
+	return fields
+}
+
+func lookupField(fields []structField, key string) (int, bool) {
+	for i, f := range fields {
+		if f.key == key {
+			return i, true
+		}
+	}
+	for i, f := range fields {
+		if strings.EqualFold(f.key, key) {
+			return i, true
+		}
+	}
+	return -1, false
+}
+
+func lookupMapKey(mv reflect.Value, key string) (reflect.Value, bool) {
+	k := reflect.ValueOf(key).Convert(mv.Type().Key())
+	if v := mv.MapIndex(k); v.IsValid() {
+		return k, true
+	}
+	for _, k = range mv.MapKeys() {
+		if strings.EqualFold(k.String(), key) {
+			return k, true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// isEmptyValue is the empty value of omitempty like encoding/json
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
+
+func sortedMapKeys(mv reflect.Value) []reflect.Value {
+	return sortMapKeys(mv.MapKeys())
+}
+
+// cmpStructMap match struct fields with map keys by json tag or field name
+func cmpStructMap(df *differ, steps []pathStep, sv, mv reflect.Value, structOnLeft bool) bool {
+	visited := make(map[string]bool)
+	for _, f := range collectFields(sv, "json", steps, nil) {
+		mvv := reflect.Value{}
+		if k, ok := lookupMapKey(mv, f.key); ok {
+			visited[k.String()] = true
+			mvv = mv.MapIndex(k)
+		}
+		if !mvv.IsValid() {
+			if f.omitEmpty && isEmptyValue(f.v) {
+				// encoding/json omits it
+				continue
+			}
+			if structOnLeft {
+				if !df.Callback(f.steps, DiffOfRightNoValue, f.v, mvv) {
+					return false
+				}
+			} else if !df.Callback(f.steps, DiffOfLeftNoValue, mvv, f.v) {
+				return false
+			}
+			continue
+		}
+		lvv, rvv := f.v, mvv
+		if !structOnLeft {
+			lvv, rvv = mvv, f.v
+		}
+		if !cmpMixed(df, f.steps, lvv, rvv) {
+			return false
+		}
+	}
+	for _, k := range sortedMapKeys(mv) {
+		if visited[k.String()] {
+			continue
+		}
+		s := appendPath(steps, fieldStep(k.String(), mv.Type().Elem()))
+		if structOnLeft {
+			if !df.Callback(s, DiffOfLeftNoValue, reflect.Value{}, mv.MapIndex(k)) {
+				return false
+			}
+		} else if !df.Callback(s, DiffOfRightNoValue, mv.MapIndex(k), reflect.Value{}) {
+			return false
+		}
+	}
+	return true
+}
+
+// cmpStructs match fields of different struct types by name or structural tag
+func cmpStructs(df *differ, steps []pathStep, lv, rv reflect.Value) bool {
+	lfields := collectFields(lv, df.structuralTag, steps, nil)
+	rfields := collectFields(rv, df.structuralTag, steps, nil)
+	visited := make([]bool, len(rfields))
+	for _, lf := range lfields {
+		i, ok := lookupField(rfields, lf.key)
+		if !ok {
+			if !df.Callback(lf.steps, DiffOfRightNoValue, lf.v, reflect.Value{}) {
+				return false
+			}
+			continue
+		}
+		visited[i] = true
+		if !cmpMixed(df, lf.steps, lf.v, rfields[i].v) {
+			return false
+		}
+	}
+	for i, rf := range rfields {
+		if visited[i] {
+			continue
+		}
+		if !df.Callback(rf.steps, DiffOfLeftNoValue, reflect.Value{}, rf.v) {
+			return false
+		}
+	}
+	return true
+}
+
+func cmpMapMixed(df *differ, steps []pathStep, lv, rv reflect.Value) bool {
+	for _, k := range sortedMapKeys(lv) {
+		s := appendPath(steps, fieldStep(k.String(), lv.Type().Elem()))
+		rk, ok := lookupMapKey(rv, k.String())
+		if !ok {
+			if !df.Callback(s, DiffOfRightNoValue, lv.MapIndex(k), reflect.Value{}) {
+				return false
+			}
+			continue
+		}
+		if !cmpMixed(df, s, lv.MapIndex(k), rv.MapIndex(rk)) {
+			return false
+		}
+	}
+	for _, k := range sortedMapKeys(rv) {
+		if _, ok := lookupMapKey(lv, k.String()); ok {
+			continue
+		}
+		if !df.Callback(appendPath(steps, fieldStep(k.String(), rv.Type().Elem())), DiffOfLeftNoValue, reflect.Value{}, rv.MapIndex(k)) {
+			return false
+		}
+	}
+	return true
+}
+
+// cmpSliceMixed compare elements by position, identity alignment needs elements of the same type
+func cmpSliceMixed(df *differ, steps []pathStep, lv, rv reflect.Value) bool {
+	for i := 0; i < lv.Len() || i < rv.Len(); i++ {
+		s := appendPath(steps, indexStep(i, lv.Type().Elem()))
+		switch {
+		case i < lv.Len() && i < rv.Len():
+			if !cmpMixed(df, s, lv.Index(i), rv.Index(i)) {
+				return false
+			}
+		case i < lv.Len():
+			if !df.Callback(s, DiffOfLeftElemRemoved, lv.Index(i), reflect.Zero(rv.Type().Elem())) {
+				return false
+			}
+		default:
+			if !df.Callback(s, DiffOfRightElemAdded, reflect.Zero(lv.Type().Elem()), rv.Index(i)) {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -22,18 +22,37 @@ func (a sliceElems) Less(i, j int) bool {
 
 type getIDFunc func(reflect.Value) string
 
+// getIDFn the id func of type is compiled once, except that there are path id funcs of the type
+func getIDFn(df *differ, steps []pathStep, et reflect.Type) getIDFunc {
+	if et != nil && df.pathIDTypes[et] {
+		if fn, ok := df.pathIDFuncs[buildPathType(replaceSliceIndexToStar(buildPath(steps)), et)]; ok {
+			return idFnOf(fn)
+		}
+	} else if fn, ok := df.plans.idFns.Load(et); ok {
+		return fn.(getIDFunc)
+	}
+	fn := buildGetIDFn(df, et)
+	df.plans.idFns.Store(et, fn)
+	return fn
+}
+
+func idFnOf(fn reflect.Value) getIDFunc {
+	return func(_v reflect.Value) string {
+		if !_v.IsValid() {
+			return _ZERO
+		}
+		out := fn.Call([]reflect.Value{_v})
+		return out[0].String()
+	}
+}
+
 func buildGetIDFn(df *differ, et reflect.Type) getIDFunc {
 	if et == nil {
 		return func(reflect.Value) string { return _ZERO }
 	}
-	if fn, ok := df.typeIDFuncs[et]; ok {
-		return func(_v reflect.Value) string {
-			if !_v.IsValid() {
-				return _ZERO
-			}
-			out := fn.Call([]reflect.Value{_v})
-			return out[0].String()
-		}
+	fn, ok := df.typeIDFuncs[et]
+	if ok {
+		return idFnOf(fn)
 	}
 	var kind reflect.Kind
 	if et.Kind() == reflect.Ptr {
@@ -41,9 +60,12 @@ func buildGetIDFn(df *differ, et reflect.Type) getIDFunc {
 	} else {
 		kind = et.Kind()
 	}
-	fn, ok := df.kindIDFuncs[kind]
+	fn, ok = df.kindIDFuncs[kind]
+	if ok && !df.customIDKinds[kind] {
+		return directIDFn(et.Kind() == reflect.Ptr)
+	}
 	if !ok {
-		fn = reflect.ValueOf(df.IDOfAnything)
+		fn = reflect.ValueOf(df.config.IDOfAnything)
 	}
 	if et.Kind() == reflect.Ptr {
 		return func(_v reflect.Value) string {
@@ -117,58 +139,68 @@ func alignSlice(ls, rs sliceElems) (left sliceElems, right sliceElems, added sli
 	return
 }
 
-func cmpSlice(df *differ, steps []string, et reflect.Type, lv, rv reflect.Value) bool {
-	df.setPathToType(buildPath(appendPath(steps, buildIndexStep(0))), et)
+func alignSliceByIndex(ll, rl int) (left sliceElems, right sliceElems, added sliceElems, deleted sliceElems) {
+	for i := 0; i < ll || i < rl; i++ {
+		switch {
+		case i < ll && i < rl:
+			left = append(left, sliceElem{idx: i})
+			right = append(right, sliceElem{idx: i})
+		case i < ll:
+			deleted = append(deleted, sliceElem{idx: i})
+		default:
+			added = append(added, sliceElem{idx: i})
+		}
+	}
+	return
+}
 
-	getIDFn := buildGetIDFn(df, et)
-	var addedID, deletedID sliceElems
-	leftID := buildSliceElems(df, et, lv, getIDFn)
-	rightID := buildSliceElems(df, et, rv, getIDFn)
-	leftID, rightID, addedID, deletedID = alignSlice(leftID, rightID)
+func cmpSlice(df *differ, steps []pathStep, et reflect.Type, lv, rv reflect.Value) bool {
+	var leftID, rightID, addedID, deletedID sliceElems
+	if df.sliceOrdered {
+		leftID, rightID, addedID, deletedID = alignSliceByIndex(lv.Len(), rv.Len())
+	} else {
+		getIDFn := getIDFn(df, steps, et)
+		leftID = buildSliceElems(df, et, lv, getIDFn)
+		rightID = buildSliceElems(df, et, rv, getIDFn)
+		leftID, rightID, addedID, deletedID = alignSlice(leftID, rightID)
+	}
 	for _, elem := range deletedID {
-		step := buildIndexStep(elem.idx)
-		if !df.Callback(buildPath(appendPath(steps, step)), DiffOfLeftElemRemoved, lv.Index(elem.idx), defaultValue(et)) {
+		if !df.Callback(appendPath(steps, indexStep(elem.idx, et)), DiffOfLeftElemRemoved, lv.Index(elem.idx), defaultValue(et)) {
 			return false
 		}
 	}
 	for _, elem := range addedID {
-		step := buildIndexStep(elem.idx)
-		if !df.Callback(buildPath(appendPath(steps, step)), DiffOfRightElemAdded, defaultValue(et), rv.Index(elem.idx)) {
+		if !df.Callback(appendPath(steps, indexStep(elem.idx, et)), DiffOfRightElemAdded, defaultValue(et), rv.Index(elem.idx)) {
+			return false
+		}
+	}
+	if df.shouldParallel(len(leftID)) {
+		return parallelEach(df, steps, len(leftID), func(child *differ, steps []pathStep, i int) bool {
+			return cmpSliceElem(child, steps, et, lv.Index(leftID[i].idx), rv.Index(rightID[i].idx), leftID[i].idx)
+		})
+	}
+	for i, lelem := range leftID {
+		relem := rightID[i]
+		if !cmpSliceElem(df, steps, et, lv.Index(lelem.idx), rv.Index(relem.idx), lelem.idx) {
 			return false
 		}
 	}
+	return true
+}
+
+func cmpSliceElem(df *differ, steps []pathStep, et reflect.Type, lvv, rvv reflect.Value, idx int) bool {
+	s := appendPath(steps, indexStep(idx, et))
 	if et.Kind() == reflect.Ptr {
-		for i, lelem := range leftID {
-			relem := rightID[i]
-			lvv, rvv := lv.Index(lelem.idx), rv.Index(relem.idx)
-			if lvv.IsNil() != rvv.IsNil() {
-				if lvv.IsNil() && !rvv.IsNil() {
-					p := buildPath(appendPath(steps, buildIndexStep(lelem.idx)))
-					if !df.Callback(p, DiffOfLeftNoValue, lvv, rvv) {
-						return false
-					}
-				} else if !lvv.IsNil() && rvv.IsNil() {
-					p := buildPath(appendPath(steps, buildIndexStep(lelem.idx)))
-					if !df.Callback(p, DiffOfRightNoValue, lvv, rvv) {
-						return false
-					}
-				}
-				continue
-			}
-			if !lvv.IsNil() {
-				if !cmpVal(df, appendPath(steps, buildIndexStep(lelem.idx)), et.Elem(), lvv.Elem(), rvv.Elem()) {
-					return false
-				}
+		if lvv.IsNil() != rvv.IsNil() {
+			if lvv.IsNil() && !rvv.IsNil() {
+				return df.Callback(s, DiffOfLeftNoValue, lvv, rvv)
 			}
+			return df.Callback(s, DiffOfRightNoValue, lvv, rvv)
 		}
-	} else {
-		for i, lelem := range leftID {
-			relem := rightID[i]
-			lvv, rvv := lv.Index(lelem.idx), rv.Index(relem.idx)
-			if !cmpVal(df, appendPath(steps, buildIndexStep(lelem.idx)), et, lvv, rvv) {
-				return false
-			}
+		if !lvv.IsNil() {
+			return cmpVal(df, s, et.Elem(), lvv.Elem(), rvv.Elem())
 		}
+		return true
 	}
-	return true
+	return cmpVal(df, s, et, lvv, rvv)
 }
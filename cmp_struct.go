@@ -4,42 +4,41 @@ import (
 	"reflect"
 )
 
-func cmpStruct(df *differ, steps []string, t reflect.Type, lv, rv reflect.Value) bool {
-	for i := 0; i < lv.NumField(); i++ {
-		lfv, rfv := lv.Field(i), rv.Field(i)
-		ft := t.Field(i)
-		if !isExported(ft.Name) {
-			continue
-		}
+func cmpStruct(df *differ, steps []pathStep, t reflect.Type, lv, rv reflect.Value) bool {
+	for _, fp := range df.structPlan(t).fields {
+		lfv, rfv := lv.Field(fp.index), rv.Field(fp.index)
+		s := appendPath(steps, fieldStep(fp.name, fp.t))
 
-		df.setPathToType(buildPath(appendPath(steps, ft.Name)), ft.Type)
-
-		if df.canCmpType(buildPath(appendPath(steps, ft.Name)), ft.Type) {
-			if !df.cmpByType(appendPath(steps, ft.Name), ft.Type, lfv, rfv) {
+		fn, ok := fp.cmpFn, fp.cmpFn.IsValid()
+		if fp.pathCmp {
+			fn, ok = df.cmpTypeFn(s, fp.t)
+		}
+		if ok {
+			if !df.cmpByType(s, fn, lfv, rfv) {
 				return false
 			}
 			continue
 		}
-		if ft.Type.Kind() == reflect.Ptr {
+		if fp.t.Kind() == reflect.Ptr {
 			if lfv.IsNil() != rfv.IsNil() {
 				if lfv.IsNil() && !rfv.IsNil() {
-					if !df.Callback(buildPath(appendPath(steps, ft.Name)), DiffOfLeftNoValue, lfv, rfv) {
+					if !df.Callback(s, DiffOfLeftNoValue, lfv, rfv) {
 						return false
 					}
 				} else if !lfv.IsNil() && rfv.IsNil() {
-					if !df.Callback(buildPath(appendPath(steps, ft.Name)), DiffOfRightNoValue, lfv, rfv) {
+					if !df.Callback(s, DiffOfRightNoValue, lfv, rfv) {
 						return false
 					}
 				}
 				continue
 			}
 			if !lfv.IsNil() {
-				if !cmpVal(df, appendPath(steps, ft.Name), ft.Type.Elem(), lfv.Elem(), rfv.Elem()) {
+				if !cmpVal(df, s, fp.t.Elem(), lfv.Elem(), rfv.Elem()) {
 					return false
 				}
 			}
 		} else {
-			if !cmpVal(df, appendPath(steps, ft.Name), ft.Type, lfv, rfv) {
+			if !cmpVal(df, s, fp.t, lfv, rfv) {
 				return false
 			}
 		}
@@ -0,0 +1,317 @@
+package diff
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Compose squash p1 and p2 into one patch, applying it equals applying p1 then p2.
+// Slice indexes of p2 are rebased through elements added and removed by p1 before rows are matched.
+// Rows of the same path are collapsed with the left value of p1, changes cancelling each other are dropped,
+// and rows under the path of another row are merged into the value of that row.
+func Compose(p1, p2 Patch) (Patch, error) {
+	c := composer{rows: make([]*D, 0, len(p1.List)+len(p2.List)), spaces: make([]rowSpace, 0, len(p1.List)+len(p2.List))}
+	for _, d := range p1.List {
+		nd := *d
+		c.rows = append(c.rows, &nd)
+		c.spaces = append(c.spaces, spaceOfAdd(&nd))
+	}
+	edits1, edits2 := sliceEditsOf(p1.List), sliceEditsOf(p2.List)
+	for _, d2 := range p2.List {
+		nd := *d2
+		var space rowSpace
+		nd.Path, space = rebasePath(d2.Path, edits1, d2.Reason == DiffOfRightElemAdded)
+		if err := c.compose(&nd, space); err != nil {
+			return Patch{}, err
+		}
+	}
+	patch := Patch{differ: p1.differ, rootType: p1.rootType}
+	for i, d := range c.rows {
+		if d == nil || isNoop(d) {
+			continue
+		}
+		// elements added by p1 are positioned in the result of p2
+		if c.spaces[i].added && d.Reason == DiffOfRightElemAdded {
+			if prefix, j, ok := lastIndexToken(d.Path); ok {
+				if m := edits2[prefix]; m != nil {
+					if j, ok = m.toRight(j); !ok {
+						continue
+					}
+					d.Path = prefix + buildIndexStep(j)
+				}
+			}
+		}
+		patch.add(d)
+	}
+	return patch, nil
+}
+
+// rowSpace is the index space of a row, rows under elements added by p1 are in the result of p1,
+// the other rows are in the left value of p1 except indexes of added elements
+type rowSpace struct {
+	added bool
+	// prefix is the path of slice of the added element
+	prefix string
+}
+
+func spaceOfAdd(d *D) rowSpace {
+	if d.Reason != DiffOfRightElemAdded {
+		return rowSpace{}
+	}
+	prefix, _, _ := lastIndexToken(d.Path)
+	return rowSpace{added: true, prefix: prefix}
+}
+
+// related whether paths of rows in spaces s1 and s2 can be matched,
+// a row in the left value only contains rows in the result of p1 if it's the slice or a parent of it
+func related(path1 string, s1 rowSpace, path2 string, s2 rowSpace) bool {
+	if s1.added == s2.added {
+		return true
+	}
+	path, prefix := path1, s2.prefix
+	if s1.added {
+		path, prefix = path2, s1.prefix
+	}
+	return path == prefix || path == _ROOT || isSubPath(path, prefix)
+}
+
+// sliceEdits elements removed by left indexes and added by right indexes of a slice
+type sliceEdits struct {
+	removed map[int]bool
+	added   map[int]bool
+}
+
+func sliceEditsOf(rows []*D) map[string]*sliceEdits {
+	edits := make(map[string]*sliceEdits)
+	for _, d := range rows {
+		if d.Reason != DiffOfLeftElemRemoved && d.Reason != DiffOfRightElemAdded {
+			continue
+		}
+		prefix, idx, ok := lastIndexToken(d.Path)
+		if !ok {
+			continue
+		}
+		m, ok := edits[prefix]
+		if !ok {
+			m = &sliceEdits{removed: make(map[int]bool), added: make(map[int]bool)}
+			edits[prefix] = m
+		}
+		if d.Reason == DiffOfLeftElemRemoved {
+			m.removed[idx] = true
+		} else {
+			m.added[idx] = true
+		}
+	}
+	return edits
+}
+
+// toLeft is the left index of element j of right, false if it's added
+func (m *sliceEdits) toLeft(j int) (int, bool) {
+	if m.added[j] {
+		return 0, false
+	}
+	return nthIndex(j-countBelow(m.added, j), m.removed), true
+}
+
+// toRight is the right index of element i of left, false if it's removed
+func (m *sliceEdits) toRight(i int) (int, bool) {
+	if m.removed[i] {
+		return 0, false
+	}
+	return nthIndex(i-countBelow(m.removed, i), m.added), true
+}
+
+func countBelow(set map[int]bool, i int) int {
+	var n int
+	for j := range set {
+		if j < i {
+			n++
+		}
+	}
+	return n
+}
+
+// nthIndex is the index of the n-th element not in skip
+func nthIndex(n int, skip map[int]bool) int {
+	for i, count := 0, 0; ; i++ {
+		if skip[i] {
+			continue
+		}
+		if count == n {
+			return i
+		}
+		count++
+	}
+}
+
+// rebasePath shift indexes of path in the result of p1 to the left value of p1 by edits of p1,
+// indexes of elements added by p1 are kept. The last index of an added row is in the result of p2 and kept.
+func rebasePath(path string, edits map[string]*sliceEdits, add bool) (string, rowSpace) {
+	var space rowSpace
+	var out strings.Builder
+	for rest := path; rest != ""; {
+		var token string
+		token, rest = nextPathToken(rest)
+		m := edits[out.String()]
+		if space.added || !isIndexToken(token) || m == nil || (rest == "" && add) {
+			out.WriteString(token)
+			continue
+		}
+		j, _ := strconv.Atoi(token[1 : len(token)-1])
+		if i, ok := m.toLeft(j); ok {
+			out.WriteString(buildIndexStep(i))
+			continue
+		}
+		space = rowSpace{added: true, prefix: out.String()}
+		out.WriteString(token)
+	}
+	return out.String(), space
+}
+
+type composer struct {
+	rows   []*D
+	spaces []rowSpace
+}
+
+func (c *composer) compose(d2 *D, space rowSpace) error {
+	if isLengthRow(d2) {
+		c.composeLength(d2, space)
+		return nil
+	}
+	add := d2.Reason == DiffOfRightElemAdded
+	for i, d1 := range c.rows {
+		switch {
+		case d1 == nil || isLengthRow(d1) || !related(d1.Path, c.spaces[i], d2.Path, space):
+			continue
+		case d1.Path == d2.Path && !add:
+			c.rows[i] = composeSamePath(d1, d2)
+			return nil
+		case isSubPath(d1.Path, d2.Path):
+			if isAbsentAfter(d1) || !d1.RightV.IsValid() {
+				return fmt.Errorf("diff: can't compose %s: %s is removed", d2.Path, d1.Path)
+			}
+			right := cloneValue(d1.RightV)
+			if err := applyRows(right, []*D{relativeD(d2, d1.Path)}, nil); err != nil {
+				return err
+			}
+			d1.RightV = right
+			return nil
+		}
+	}
+	if add {
+		c.rows, c.spaces = append(c.rows, d2), append(c.spaces, space)
+		return nil
+	}
+	// d2 replaces values changed by rows of p1, the left value is restored by reverting them
+	first := -1
+	var children []*D
+	for i, d1 := range c.rows {
+		if d1 != nil && isLengthRow(d1) && (d1.Path == d2.Path || isSubPath(d2.Path, d1.Path)) {
+			// the length is described by d2
+			c.rows[i] = nil
+			continue
+		}
+		if d1 != nil && related(d1.Path, c.spaces[i], d2.Path, space) && isSubPath(d2.Path, d1.Path) {
+			if first < 0 {
+				first = i
+			}
+			children = append(children, invertD(relativeD(d1, d2.Path)))
+			c.rows[i] = nil
+		}
+	}
+	if first < 0 {
+		c.rows, c.spaces = append(c.rows, d2), append(c.spaces, space)
+		return nil
+	}
+	if isAbsentBefore(d2) || !d2.LeftV.IsValid() {
+		return fmt.Errorf("diff: can't compose %s: it's added after changes of its children", d2.Path)
+	}
+	left := cloneValue(d2.LeftV)
+	for i := len(children) - 1; i >= 0; i-- {
+		if err := applyRows(left, children[i:i+1], nil); err != nil {
+			return err
+		}
+	}
+	d2.LeftV = left
+	c.rows[first], c.spaces[first] = d2, space
+	return nil
+}
+
+// composeLength collapse length rows of the same path, they only describe the change of element rows
+func (c *composer) composeLength(d2 *D, space rowSpace) {
+	for i, d1 := range c.rows {
+		if d1 != nil && isLengthRow(d1) && d1.Path == d2.Path && related(d1.Path, c.spaces[i], d2.Path, space) {
+			c.rows[i] = &D{Path: d1.Path, Reason: d2.Reason, LeftV: d1.LeftV, RightV: d2.RightV}
+			return
+		}
+	}
+	c.rows, c.spaces = append(c.rows, d2), append(c.spaces, space)
+}
+
+func composeSamePath(d1, d2 *D) *D {
+	nd := &D{Path: d1.Path, Reason: DiffOfValue, LeftV: d1.LeftV, RightV: d2.RightV}
+	before, after := isAbsentBefore(d1), isAbsentAfter(d2)
+	switch {
+	case before && after:
+		return nil
+	case before:
+		nd.Reason = d1.Reason
+	case after:
+		nd.Reason = d2.Reason
+	case d1.Reason == DiffOfType || d2.Reason == DiffOfType:
+		nd.Reason = DiffOfType
+	}
+	return nd
+}
+
+// isNoop the row changes nothing
+func isNoop(d *D) bool {
+	if isAbsentBefore(d) || isAbsentAfter(d) || !d.LeftV.IsValid() || !d.RightV.IsValid() {
+		return false
+	}
+	if !d.LeftV.CanInterface() || !d.RightV.CanInterface() || d.LeftV.Type() != d.RightV.Type() {
+		return false
+	}
+	return defaultDiffer.Compare(d.LeftV.Interface(), d.RightV.Interface(), nil)
+}
+
+func isAbsentBefore(d *D) bool {
+	return d.Reason == DiffOfRightElemAdded || (d.Reason == DiffOfLeftNoValue && !d.LeftV.IsValid())
+}
+
+func isAbsentAfter(d *D) bool {
+	return d.Reason == DiffOfLeftElemRemoved || (d.Reason == DiffOfRightNoValue && !d.RightV.IsValid())
+}
+
+// isSubPath whether sub is under parent
+func isSubPath(parent, sub string) bool {
+	if parent == _ROOT {
+		return sub != _ROOT
+	}
+	return len(sub) > len(parent) && strings.HasPrefix(sub, parent) && (sub[len(parent)] == '.' || sub[len(parent)] == '[')
+}
+
+// relativeD the row with path relative to parent
+func relativeD(d *D, parent string) *D {
+	nd := *d
+	if parent != _ROOT {
+		nd.Path = d.Path[len(parent):]
+	}
+	return &nd
+}
+
+func invertD(d *D) *D {
+	nd := &D{Path: d.Path, Reason: d.Reason, LeftV: d.RightV, RightV: d.LeftV}
+	switch d.Reason {
+	case DiffOfLeftNoValue:
+		nd.Reason = DiffOfRightNoValue
+	case DiffOfRightNoValue:
+		nd.Reason = DiffOfLeftNoValue
+	case DiffOfLeftElemRemoved:
+		nd.Reason = DiffOfRightElemAdded
+	case DiffOfRightElemAdded:
+		nd.Reason = DiffOfLeftElemRemoved
+	}
+	return nd
+}
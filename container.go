@@ -0,0 +1,64 @@
+package diff
+
+import (
+	"reflect"
+)
+
+// LengthMode is how length differences of slices and maps are reported
+type LengthMode int
+
+const (
+	// LengthNone no length row, it's the default
+	LengthNone LengthMode = iota
+	// LengthWithElems a DiffOfSliceLength/DiffOfMapLength row with both lengths before rows of elements
+	LengthWithElems
+	// LengthOnly a DiffOfSliceLength/DiffOfMapLength row with both lengths instead of rows of elements
+	LengthOnly
+)
+
+// WithLengthMode report length differences of slices and maps by mode, length rows are skipped by Patch.Apply
+func WithLengthMode(mode LengthMode) Option {
+	return func(c *config) {
+		c.lengthMode = mode
+	}
+}
+
+// WithCollapse report a slice or map with more than n rows of elements as one DiffOfValue row of the whole value, n <= 0 means no collapse
+func WithCollapse(n int) Option {
+	return func(c *config) {
+		c.collapse = n
+	}
+}
+
+// plainContainer elements of slices and maps are reported as they are
+func (c *config) plainContainer() bool {
+	return c.lengthMode == LengthNone && c.collapse <= 0
+}
+
+// cmpContainer compare elements of slice or map by cmp, with the length row and collapse applied
+func cmpContainer(df *differ, steps []pathStep, reason Reason, lv, rv reflect.Value, cmp func(*differ) bool) bool {
+	if df.lengthMode != LengthNone && lv.Len() != rv.Len() {
+		if !df.Callback(steps, reason, reflect.ValueOf(lv.Len()), reflect.ValueOf(rv.Len())) {
+			return false
+		}
+		if df.lengthMode == LengthOnly {
+			return true
+		}
+	}
+	if df.collapse <= 0 || df.fn == nil {
+		return cmp(df)
+	}
+	var rows []*D
+	child := acquireChildDiffer(df, func(d *D) bool {
+		rows = append(rows, d)
+		return true
+	})
+	child.rootType = df.rootType
+	ok := cmp(child)
+	diff := child.differenceExist
+	releaseDiffer(child)
+	if len(rows) > df.collapse {
+		return df.Callback(steps, DiffOfValue, lv, rv)
+	}
+	return df.replay(rows, diff) && ok
+}
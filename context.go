@@ -0,0 +1,138 @@
+package diff
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	// ErrMaxDepth the traversal is deeper than MaxDepth
+	ErrMaxDepth = errors.New("diff: max depth exceeded")
+	// ErrMaxNodes more nodes than MaxNodes are visited
+	ErrMaxNodes = errors.New("diff: max nodes exceeded")
+	// ErrMaxDiffs more differences than MaxDiffs are found
+	ErrMaxDiffs = errors.New("diff: max diffs exceeded")
+)
+
+// _CTX_CHECK_INTERVAL is the number of nodes between two checks of ctx.Done()
+const _CTX_CHECK_INTERVAL = 1024
+
+// MaxDepth stop traversal with ErrMaxDepth when a path has more than n steps
+func MaxDepth(n int) Option {
+	return func(c *config) {
+		c.maxDepth = n
+	}
+}
+
+// MaxNodes stop traversal with ErrMaxNodes when more than n nodes are visited
+func MaxNodes(n int) Option {
+	return func(c *config) {
+		c.maxNodes = n
+	}
+}
+
+// MaxDiffs stop traversal with ErrMaxDiffs when more than n differences are found, the first n are reported
+func MaxDiffs(n int) Option {
+	return func(c *config) {
+		c.maxDiffs = n
+	}
+}
+
+// CompareContext is Compare which stops when ctx is done or a limit is hit, the error is ctx.Err() or one of ErrMaxDepth, ErrMaxNodes and ErrMaxDiffs
+func (df *Differ) CompareContext(ctx context.Context, l interface{}, r interface{}, fn Callback) (equal bool, err error) {
+	return df.compare(ctx, l, r, fn)
+}
+
+// MakePatchContext is MakePatch which stops when ctx is done or a limit is hit, the patch found so far is returned with the error
+func (df *Differ) MakePatchContext(ctx context.Context, l interface{}, r interface{}) (Patch, error) {
+	patch := Patch{differ: df, rootType: reflect.TypeOf(l)}
+	fn := func(_d *D) bool {
+		patch.add(_d)
+		return true
+	}
+	_, err := df.compare(ctx, l, r, fn)
+	return patch, err
+}
+
+// budget limits a traversal, it's shared by the differs of parallel comparison
+type budget struct {
+	ctx      context.Context
+	maxDepth int
+	maxNodes int64
+	maxDiffs int
+	nodes    int64
+	diffs    int
+	stopped  int32
+	errOnce  sync.Once
+	err      error
+}
+
+func newBudget(ctx context.Context, c *config) *budget {
+	if ctx.Done() == nil && c.maxDepth <= 0 && c.maxNodes <= 0 && c.maxDiffs <= 0 {
+		return nil
+	}
+	return &budget{ctx: ctx, maxDepth: c.maxDepth, maxNodes: int64(c.maxNodes), maxDiffs: c.maxDiffs}
+}
+
+// enter a node at depth, false means the traversal should stop
+func (b *budget) enter(depth int) bool {
+	if atomic.LoadInt32(&b.stopped) == 1 {
+		return false
+	}
+	if b.maxDepth > 0 && depth > b.maxDepth {
+		return b.fail(fmt.Errorf("%w: %d", ErrMaxDepth, b.maxDepth))
+	}
+	n := atomic.AddInt64(&b.nodes, 1)
+	if b.maxNodes > 0 && n > b.maxNodes {
+		return b.fail(fmt.Errorf("%w: %d", ErrMaxNodes, b.maxNodes))
+	}
+	if n%_CTX_CHECK_INTERVAL == 1 {
+		select {
+		case <-b.ctx.Done():
+			return b.fail(b.ctx.Err())
+		default:
+		}
+	}
+	return true
+}
+
+// addDiff count a reported difference, it's called by the root differ only
+func (b *budget) addDiff() bool {
+	if b.maxDiffs > 0 && b.diffs >= b.maxDiffs {
+		return b.fail(fmt.Errorf("%w: %d", ErrMaxDiffs, b.maxDiffs))
+	}
+	b.diffs++
+	return true
+}
+
+func (b *budget) fail(err error) bool {
+	b.errOnce.Do(func() {
+		b.err = err
+		atomic.StoreInt32(&b.stopped, 1)
+	})
+	return false
+}
+
+func (b *budget) failed() bool {
+	return atomic.LoadInt32(&b.stopped) == 1
+}
+
+// enter a node, false means the traversal should stop
+func (df *differ) enter(steps []pathStep) bool {
+	return df.budget == nil || df.budget.enter(len(steps))
+}
+
+func (df *differ) addDiff() bool {
+	return df.budget == nil || df.budget.addDiff()
+}
+
+func (df *differ) stopErr() error {
+	if df.budget == nil || !df.budget.failed() {
+		return nil
+	}
+	return df.budget.err
+}
@@ -808,3 +808,376 @@ func TestOmitPath2(t *testing.T) {
 	}
 
 }
+
+func TestPathIDFunc(t *testing.T) {
+	type Item struct {
+		SKU string
+		N   int
+	}
+	type Order struct {
+		Items []Item
+		Gifts []Item
+	}
+	o1 := Order{Items: []Item{{SKU: "a", N: 1}, {SKU: "b", N: 2}}, Gifts: []Item{{SKU: "a", N: 1}, {SKU: "b", N: 2}}}
+	o2 := Order{Items: []Item{{SKU: "b", N: 2}, {SKU: "a", N: 1}}, Gifts: []Item{{SKU: "b", N: 2}, {SKU: "a", N: 1}}}
+	df := New()
+	if err := df.RegistPathIDFunc(".Items", func(i Item) string { return i.SKU }); err != nil {
+		t.Fatal(err)
+	}
+	patch := df.MakePatch(o1, o2)
+	for _, d := range patch.List {
+		if !strings.HasPrefix(d.Path, ".Gifts") {
+			t.Fatal("items should align by sku", d.Path)
+		}
+	}
+	if patch.IsEmpty() {
+		t.Fatal("gifts should not align by sku")
+	}
+}
+
+func TestSliceOrdered(t *testing.T) {
+	df := New()
+	if !df.Compare([]string{"a", "b"}, []string{"b", "a"}, nil) {
+		t.Fatal("should equal")
+	}
+	df.SetSliceOrdered(true)
+	patch := df.MakePatch([]string{"a", "b", "c"}, []string{"b", "a"})
+	if patch.Size() != 3 {
+		t.Fatal("bad patch", patch.Readable())
+	}
+	if patch.List[0].Path != ".[2]" || patch.List[0].Reason != DiffOfLeftElemRemoved {
+		t.Fatal("bad patch", patch.Readable())
+	}
+	if patch.List[1].Path != ".[0]" || patch.List[2].Path != ".[1]" {
+		t.Fatal("bad patch", patch.Readable())
+	}
+}
+
+func TestUntypedJSON(t *testing.T) {
+	m1 := map[string]interface{}{"a": 1.0, "b": nil, "c": "x"}
+	m2 := map[string]interface{}{"a": "1", "b": map[string]interface{}{"x": 1.0}, "c": nil}
+	reasons := make(map[string]Reason)
+	New().Compare(m1, m2, func(d *D) bool {
+		reasons[d.Path] = d.Reason
+		return true
+	})
+	if reasons[".a"] != DiffOfType || reasons[".b"] != DiffOfLeftNoValue || reasons[".c"] != DiffOfRightNoValue {
+		t.Fatal("bad diff", reasons)
+	}
+	if !CompareValue(nil, nil) {
+		t.Fatal("should equal")
+	}
+	if CompareValue(nil, m1) {
+		t.Fatal("should not equal")
+	}
+}
+
+func TestStructWithMap(t *testing.T) {
+	type Base struct {
+		ID int `json:"id"`
+	}
+	type Addr struct {
+		Street string
+		Zip    *int `json:"zip,omitempty"`
+	}
+	type Account struct {
+		Base
+		Name    string    `json:"name"`
+		Age     int64     `json:"age"`
+		Score   float32   `json:"score"`
+		Addr    *Addr     `json:"addr"`
+		Tags    []string  `json:"tags"`
+		Created time.Time `json:"created"`
+		Secret  string    `json:"-"`
+	}
+	created := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	acc := Account{Base: Base{ID: 1}, Name: "a", Age: 18, Score: 1.5, Addr: &Addr{Street: "s"}, Tags: []string{"x"}, Created: created, Secret: "x"}
+	edit := map[string]interface{}{
+		"id":      1.0,
+		"name":    "a",
+		"age":     18.0,
+		"score":   1.5,
+		"addr":    map[string]interface{}{"street": "s"},
+		"tags":    []interface{}{"x"},
+		"created": created.Format(time.RFC3339),
+	}
+	df := New()
+	if !df.Compare(acc, edit, func(d *D) bool {
+		t.Log(d.Path, d.Reason)
+		return true
+	}) {
+		t.Fatal("should equal")
+	}
+	zip := 100
+	acc.Addr.Zip = &zip
+	if df.Compare(acc, edit, nil) {
+		t.Fatal("non-empty omitempty field should be compared")
+	}
+	acc.Addr.Zip = nil
+	edit["age"] = 19.0
+	edit["tags"] = []interface{}{"x", "y"}
+	edit["extra"] = true
+	delete(edit, "name")
+	reasons := make(map[string]Reason)
+	if df.Compare(&acc, edit, func(d *D) bool {
+		reasons[d.Path] = d.Reason
+		return true
+	}) {
+		t.Fatal("should not equal")
+	}
+	expect := map[string]Reason{
+		".Age":     DiffOfValue,
+		".Tags[1]": DiffOfRightElemAdded,
+		".extra":   DiffOfLeftNoValue,
+		".Name":    DiffOfRightNoValue,
+	}
+	if !reflect.DeepEqual(reasons, expect) {
+		t.Fatal("bad diff", reasons)
+	}
+	reasons = make(map[string]Reason)
+	df.Compare(edit, acc, func(d *D) bool {
+		reasons[d.Path] = d.Reason
+		return true
+	})
+	if reasons[".extra"] != DiffOfRightNoValue || reasons[".Name"] != DiffOfLeftNoValue || reasons[".Tags[1]"] != DiffOfLeftElemRemoved {
+		t.Fatal("bad diff", reasons)
+	}
+}
+
+func TestStructural(t *testing.T) {
+	type AddrDTO struct {
+		Street string `json:"street"`
+	}
+	type UserDTO struct {
+		ID    int64     `json:"id"`
+		Name  string    `json:"name"`
+		Addr  *AddrDTO  `json:"addr"`
+		Pets  []AddrDTO `json:"pets"`
+		Email string    `json:"email"`
+	}
+	type Addr struct {
+		Street string `json:"street"`
+	}
+	type User struct {
+		BaseDomain
+		FullName string `json:"name"`
+		Addr     Addr   `json:"addr"`
+		Pets     []Addr `json:"pets"`
+		Phone    string `json:"phone"`
+	}
+	dto := UserDTO{ID: 1, Name: "a", Addr: &AddrDTO{Street: "s"}, Pets: []AddrDTO{{Street: "p"}}, Email: "e"}
+	user := User{BaseDomain: BaseDomain{ID: 1}, FullName: "a", Addr: Addr{Street: "s"}, Pets: []Addr{{Street: "p"}}, Phone: "p"}
+	df := New()
+	if df.Compare(dto, user, nil) {
+		t.Fatal("different types should not equal")
+	}
+	df.SetStructural(true)
+	reasons := make(map[string]Reason)
+	df.Compare(dto, user, func(d *D) bool {
+		reasons[d.Path] = d.Reason
+		return true
+	})
+	expect := map[string]Reason{
+		".Name":                  DiffOfRightNoValue,
+		".Email":                 DiffOfRightNoValue,
+		".BaseDomain.CreateTime": DiffOfLeftNoValue,
+		".FullName":              DiffOfLeftNoValue,
+		".Phone":                 DiffOfLeftNoValue,
+	}
+	if !reflect.DeepEqual(reasons, expect) {
+		t.Fatal("bad diff", reasons)
+	}
+	df.SetStructuralTag("json")
+	df.OmitPath("CreateTime")
+	reasons = make(map[string]Reason)
+	df.Compare(&dto, &user, func(d *D) bool {
+		reasons[d.Path] = d.Reason
+		return true
+	})
+	expect = map[string]Reason{
+		".Email": DiffOfRightNoValue,
+		".Phone": DiffOfLeftNoValue,
+	}
+	if !reflect.DeepEqual(reasons, expect) {
+		t.Fatal("bad diff", reasons)
+	}
+	user.Pets[0].Street = "q"
+	user.FullName = "b"
+	patch := df.MakePatch(dto, user)
+	if d := patch.List[0]; d.Path != ".Name" || d.Reason != DiffOfValue || d.RightV.String() != "b" {
+		t.Fatal("bad diff", patch.Readable())
+	}
+	if d := patch.List[1]; d.Path != ".Pets[0].Street" || d.Reason != DiffOfValue {
+		t.Fatal("bad diff", patch.Readable())
+	}
+}
+
+func TestAutoDeref(t *testing.T) {
+	type Inner struct {
+		Num int
+	}
+	type Outer struct {
+		Name  string
+		Inner interface{}
+	}
+	s := "a"
+	ps := &s
+	df := New()
+	if df.Compare(s, &s, nil) {
+		t.Fatal("should not equal without auto deref")
+	}
+	df.SetAutoDeref(true)
+	if !df.Compare(s, &s, nil) || !df.Compare(&ps, &s, nil) || !df.Compare(&ps, s, nil) {
+		t.Fatal("should equal")
+	}
+	var nilPtr *string
+	var reason Reason
+	df.Compare(nilPtr, &ps, func(d *D) bool {
+		reason = d.Reason
+		return true
+	})
+	if reason != DiffOfLeftNoValue {
+		t.Fatal("bad reason", reason)
+	}
+	df.Compare(&ps, nilPtr, func(d *D) bool {
+		reason = d.Reason
+		return true
+	})
+	if reason != DiffOfRightNoValue {
+		t.Fatal("bad reason", reason)
+	}
+	o1 := Outer{Name: "a", Inner: Inner{Num: 1}}
+	o2 := &Outer{Name: "a", Inner: &Inner{Num: 2}}
+	patch := df.MakePatch(o1, o2)
+	if patch.Size() != 1 || patch.List[0].Path != ".Inner.Num" || patch.List[0].Reason != DiffOfValue {
+		t.Fatal("bad patch", patch.Readable())
+	}
+	o2.Inner = (*Inner)(nil)
+	patch = df.MakePatch(o1, o2)
+	if patch.Size() != 1 || patch.List[0].Path != ".Inner" || patch.List[0].Reason != DiffOfRightNoValue {
+		t.Fatal("bad patch", patch.Readable())
+	}
+
+	// element types of containers are dereferenced too
+	t1, t2 := "x", "y"
+	if !df.Compare([]string{"x", "y"}, []*string{&t1, &t2}, nil) || !df.Compare(map[string]string{"k": "x"}, map[string]*string{"k": &t1}, nil) {
+		t.Fatal("containers should equal")
+	}
+	if !df.Compare([2]Inner{{Num: 1}}, []*Inner{{Num: 1}, {}}, nil) {
+		t.Fatal("list of structs should equal")
+	}
+	patch = df.MakePatch(map[string]Inner{"a": {Num: 1}}, map[string]*Inner{"a": {Num: 2}, "b": {}})
+	if d, ok := patch.Get(".a.Num"); !ok || d.Reason != DiffOfValue || !patch.Has(".b") || patch.Size() != 2 {
+		t.Fatal("bad patch", patch.Readable())
+	}
+	if New().Compare([]string{"x"}, []*string{&t1}, nil) {
+		t.Fatal("should not equal without auto deref")
+	}
+}
+
+func makeSnapshot(n int) []*HugeStruct {
+	list := make([]*HugeStruct, n)
+	for i := range list {
+		list[i] = makeHugeStruct()
+		list[i].ID = stringPtr(fmt.Sprint(i))
+	}
+	return list
+}
+
+func BenchmarkMakePatch(b *testing.B) {
+	l, r := makeSnapshot(1000), makeSnapshot(1000)
+	for i := 0; i < len(r); i += 10 {
+		r[i].Name = "changed"
+	}
+	df := New()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if patch := df.MakePatch(l, r); patch.Size() != 100 {
+			b.Fatal("bad patch", patch.Size())
+		}
+	}
+}
+
+type flatStruct struct {
+	Name   string
+	Age    int
+	Score  float64
+	Ptr    *string
+	Inner  BasicInfo
+	Nested *Company
+}
+
+func makeFlatStruct() *flatStruct {
+	return &flatStruct{
+		Name:   "name",
+		Age:    10,
+		Score:  1.5,
+		Ptr:    stringPtr("ptr"),
+		Inner:  BasicInfo{Name: stringPtr("basic name"), Mobile: stringPtr("111111")},
+		Nested: &Company{Name: "google", Link: stringPtr("www.google.com")},
+	}
+}
+
+func TestCompareValueAllocs(t *testing.T) {
+	if raceEnabled {
+		t.Skip("allocations are not stable with race detector")
+	}
+	l, r := makeFlatStruct(), makeFlatStruct()
+	// warm up the plans
+	CompareValue(l, r)
+	if allocs := testing.AllocsPerRun(100, func() {
+		if !CompareValue(l, r) {
+			t.Fatal("should equal")
+		}
+	}); allocs > 0 {
+		t.Fatal("equality check of structs should not allocate", allocs)
+	}
+	r.Nested.Name = "aws"
+	if allocs := testing.AllocsPerRun(100, func() {
+		if CompareValue(l, r) {
+			t.Fatal("should not equal")
+		}
+	}); allocs > 0 {
+		t.Fatal("equality check of structs should not allocate", allocs)
+	}
+}
+
+func TestCompareMapAllocs(t *testing.T) {
+	if raceEnabled {
+		t.Skip("allocations are not stable with race detector")
+	}
+	l, r := make(map[string]int), make(map[string]int)
+	for i := 0; i < 64; i++ {
+		l[fmt.Sprint(i)], r[fmt.Sprint(i)] = i, i
+	}
+	CompareValue(l, r)
+	// keys are not sorted without rows to report, only values looked up from right are allocated
+	if allocs := testing.AllocsPerRun(100, func() {
+		if !CompareValue(l, r) {
+			t.Fatal("should equal")
+		}
+	}); allocs > float64(len(r)+2) {
+		t.Fatal("equality check of maps should not sort keys", allocs)
+	}
+}
+
+func BenchmarkCompareValue(b *testing.B) {
+	l, r := makeFlatStruct(), makeFlatStruct()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if !CompareValue(l, r) {
+			b.Fatal("should equal")
+		}
+	}
+}
+
+func BenchmarkCompareValueHuge(b *testing.B) {
+	l, r := makeHugeStruct(), makeHugeStruct()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if !CompareValue(l, r) {
+			b.Fatal("should equal")
+		}
+	}
+}
@@ -2,8 +2,11 @@ package diff
 
 import (
 	"errors"
+	"fmt"
 	"reflect"
 	"strings"
+	"sync"
+	"sync/atomic"
 )
 
 // Reason constants
@@ -52,13 +55,49 @@ func (re Reason) String() string {
 	return "Diff Unknown"
 }
 
+var reasonTexts = map[Reason]string{
+	DiffOfUnknown:         "unknown",
+	DiffOfType:            "type",
+	DiffOfSliceLength:     "slice_length",
+	DiffOfMapLength:       "map_length",
+	DiffOfValue:           "value",
+	DiffOfLeftNoValue:     "left_no_value",
+	DiffOfRightNoValue:    "right_no_value",
+	DiffOfLeftElemRemoved: "left_elem_removed",
+	DiffOfRightElemAdded:  "right_elem_added",
+}
+
+// MarshalText is the stable name of reason
+func (re Reason) MarshalText() ([]byte, error) {
+	if text, ok := reasonTexts[re]; ok {
+		return []byte(text), nil
+	}
+	return nil, fmt.Errorf("unknown reason %d", int(re))
+}
+
+// UnmarshalText parse the stable name of reason
+func (re *Reason) UnmarshalText(text []byte) error {
+	for r, t := range reasonTexts {
+		if t == string(text) {
+			*re = r
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown reason %q", text)
+}
+
 // Callback invoked when left is different with right
 type Callback func(*D) (shouldContinue bool)
 
-type callbackD func(path string, reason Reason, leftV reflect.Value, rightV reflect.Value) (shouldContinue bool)
-
-// Differ with compare functions
+// Differ with compare functions, it's safe to compare and regist concurrently
 type Differ struct {
+	// mu serializes writers, readers load the frozen config without lock
+	mu  sync.Mutex
+	cfg atomic.Value
+}
+
+// config is frozen once stored into Differ, modification should be done on a clone
+type config struct {
 	// the cmpFunc should be func(left,right customType) bool
 	cmpPathFuncs map[pathType]reflect.Value
 	// the cmpFunc should be func(left,right customType) bool
@@ -68,8 +107,42 @@ type Differ struct {
 	// typeIDFunc should be func(v cumstomType) (id string)
 	typeIDFuncs map[reflect.Type]reflect.Value
 	kindIDFuncs map[reflect.Kind]reflect.Value
-	omitPaths   map[string]bool
-	omitPrefix  map[string]bool
+	// pathIDFuncs should be func(v cumstomType) (id string), the path is the slice path
+	pathIDFuncs map[pathType]reflect.Value
+	// pathCmpTypes/pathIDTypes are types with path funcs, paths are built only for them
+	pathCmpTypes map[reflect.Type]bool
+	pathIDTypes  map[reflect.Type]bool
+	// customKinds/customIDKinds are kinds with user funcs, the others are compared/identified directly
+	customKinds   map[reflect.Kind]bool
+	customIDKinds map[reflect.Kind]bool
+	omitPaths     map[string]bool
+	omitPrefix    map[string]bool
+	// resolvers of merge conflicts
+	pathResolvers map[string]Resolver
+	typeResolvers map[reflect.Type]Resolver
+	sliceOrdered  bool
+	// structural compare different struct types field by field
+	structural    bool
+	structuralTag string
+	// autoDeref compare T with *T, **T with *T
+	autoDeref bool
+	// parallelism is the number of goroutines to compare elements of large slices and maps
+	parallelism       int
+	parallelThreshold int
+	// limits of traversal, see MaxDepth, MaxNodes and MaxDiffs
+	maxDepth int
+	maxNodes int
+	maxDiffs int
+	// snapshot deep copy values of D
+	snapshot bool
+	// lengthMode and collapse of slices and maps, see WithLengthMode and WithCollapse
+	lengthMode LengthMode
+	collapse   int
+	// expandSubtrees report leaves of subtrees added or removed as a whole
+	expandSubtrees bool
+	// plans are compiled lazily and dropped with the config
+	plans     *planCache
+	typeCache *typeIDCache
 }
 
 type pathType struct {
@@ -77,91 +150,276 @@ type pathType struct {
 	T reflect.Type
 }
 type differ struct {
-	*Differ
-	// Callback when diff value found
-	Callback        callbackD
+	*config
+	// fn is the user callback, nil means equality check only
+	fn              Callback
 	differenceExist bool
-	typeCache       *typeIDCache
-	pathToType      map[string]reflect.Type
-}
-
-// New differ with default config
-func New() *Differ {
-	df := &Differ{
-		cmpFuncs:     make(map[reflect.Type]reflect.Value),
-		cmpPathFuncs: make(map[pathType]reflect.Value),
-		cmpKindFuncs: make(map[reflect.Kind]reflect.Value),
-		typeIDFuncs:  make(map[reflect.Type]reflect.Value),
-		kindIDFuncs:  make(map[reflect.Kind]reflect.Value),
-		omitPaths:    make(map[string]bool),
-		omitPrefix:   make(map[string]bool),
-	}
-	df.registDefaultCmpFuncs()
+	rootType        reflect.Type
+	steps           []pathStep
+	// nested differ compares an element in parallel, it never forks again
+	nested bool
+	// budget is nil if there is no limit
+	budget *budget
+}
+
+// New differ with default config and options
+func New(opts ...Option) *Differ {
+	c := newConfig()
+	c.registDefaultCmpFuncs()
+	for _, opt := range opts {
+		opt(c)
+	}
+	df := &Differ{}
+	df.cfg.Store(c)
 	return df
 }
 
+// With derive a new differ from df with more options, df is not changed
+func (df *Differ) With(opts ...Option) *Differ {
+	c := df.load().clone()
+	for _, opt := range opts {
+		opt(c)
+	}
+	ndf := &Differ{}
+	ndf.cfg.Store(c)
+	return ndf
+}
+
+func newConfig() *config {
+	return &config{
+		cmpFuncs:      make(map[reflect.Type]reflect.Value),
+		cmpPathFuncs:  make(map[pathType]reflect.Value),
+		cmpKindFuncs:  make(map[reflect.Kind]reflect.Value),
+		typeIDFuncs:   make(map[reflect.Type]reflect.Value),
+		kindIDFuncs:   make(map[reflect.Kind]reflect.Value),
+		pathIDFuncs:   make(map[pathType]reflect.Value),
+		pathCmpTypes:  make(map[reflect.Type]bool),
+		pathIDTypes:   make(map[reflect.Type]bool),
+		customKinds:   make(map[reflect.Kind]bool),
+		customIDKinds: make(map[reflect.Kind]bool),
+		omitPaths:     make(map[string]bool),
+		omitPrefix:    make(map[string]bool),
+		pathResolvers: make(map[string]Resolver),
+		typeResolvers: make(map[reflect.Type]Resolver),
+		plans:         newPlanCache(),
+		typeCache:     newTypeIDCache(),
+	}
+}
+
+func (c *config) clone() *config {
+	nc := *c
+	nc.cmpFuncs = make(map[reflect.Type]reflect.Value, len(c.cmpFuncs))
+	for k, v := range c.cmpFuncs {
+		nc.cmpFuncs[k] = v
+	}
+	nc.cmpPathFuncs = make(map[pathType]reflect.Value, len(c.cmpPathFuncs))
+	for k, v := range c.cmpPathFuncs {
+		nc.cmpPathFuncs[k] = v
+	}
+	nc.cmpKindFuncs = make(map[reflect.Kind]reflect.Value, len(c.cmpKindFuncs))
+	for k, v := range c.cmpKindFuncs {
+		nc.cmpKindFuncs[k] = v
+	}
+	nc.typeIDFuncs = make(map[reflect.Type]reflect.Value, len(c.typeIDFuncs))
+	for k, v := range c.typeIDFuncs {
+		nc.typeIDFuncs[k] = v
+	}
+	nc.kindIDFuncs = make(map[reflect.Kind]reflect.Value, len(c.kindIDFuncs))
+	for k, v := range c.kindIDFuncs {
+		nc.kindIDFuncs[k] = v
+	}
+	nc.pathIDFuncs = make(map[pathType]reflect.Value, len(c.pathIDFuncs))
+	for k, v := range c.pathIDFuncs {
+		nc.pathIDFuncs[k] = v
+	}
+	nc.pathCmpTypes = make(map[reflect.Type]bool, len(c.pathCmpTypes))
+	for k, v := range c.pathCmpTypes {
+		nc.pathCmpTypes[k] = v
+	}
+	nc.pathIDTypes = make(map[reflect.Type]bool, len(c.pathIDTypes))
+	for k, v := range c.pathIDTypes {
+		nc.pathIDTypes[k] = v
+	}
+	nc.customKinds = make(map[reflect.Kind]bool, len(c.customKinds))
+	for k, v := range c.customKinds {
+		nc.customKinds[k] = v
+	}
+	nc.customIDKinds = make(map[reflect.Kind]bool, len(c.customIDKinds))
+	for k, v := range c.customIDKinds {
+		nc.customIDKinds[k] = v
+	}
+	nc.omitPaths = make(map[string]bool, len(c.omitPaths))
+	for k, v := range c.omitPaths {
+		nc.omitPaths[k] = v
+	}
+	nc.omitPrefix = make(map[string]bool, len(c.omitPrefix))
+	for k, v := range c.omitPrefix {
+		nc.omitPrefix[k] = v
+	}
+	nc.pathResolvers = make(map[string]Resolver, len(c.pathResolvers))
+	for k, v := range c.pathResolvers {
+		nc.pathResolvers[k] = v
+	}
+	nc.typeResolvers = make(map[reflect.Type]Resolver, len(c.typeResolvers))
+	for k, v := range c.typeResolvers {
+		nc.typeResolvers[k] = v
+	}
+	nc.plans = newPlanCache()
+	nc.typeCache = newTypeIDCache()
+	return &nc
+}
+
+func (df *Differ) load() *config {
+	return df.cfg.Load().(*config)
+}
+
+// update modify a clone of config then replace the frozen one
+func (df *Differ) update(fn func(*config) error) error {
+	df.mu.Lock()
+	defer df.mu.Unlock()
+	c := df.load().clone()
+	if err := fn(c); err != nil {
+		return err
+	}
+	df.cfg.Store(c)
+	return nil
+}
+
 func newDiffer(d *Differ, fn Callback) *differ {
-	_diff := &differ{
-		Differ:     d,
-		typeCache:  newTypeIDCache(),
-		pathToType: make(map[string]reflect.Type),
+	return &differ{config: d.load(), fn: fn}
+}
+
+// differPool reuses differ and its steps stack, so that equality check does not allocate
+var differPool = sync.Pool{
+	New: func() interface{} {
+		return &differ{steps: make([]pathStep, 0, _STEPS_CAP)}
+	},
+}
+
+func acquireDiffer(d *Differ, fn Callback) *differ {
+	df := differPool.Get().(*differ)
+	df.config, df.fn = d.load(), fn
+	return df
+}
+
+func acquireChildDiffer(parent *differ, fn Callback) *differ {
+	df := differPool.Get().(*differ)
+	df.config, df.fn, df.nested, df.budget = parent.config, fn, true, parent.budget
+	return df
+}
+
+func releaseDiffer(df *differ) {
+	steps := df.steps[:cap(df.steps)]
+	for i := range steps {
+		steps[i] = pathStep{}
+	}
+	*df = differ{steps: steps[:0]}
+	differPool.Put(df)
+}
+
+// Callback is invoked when diff value found, the path and D are built only when fn is set
+func (df *differ) Callback(steps []pathStep, reason Reason, leftV reflect.Value, rightV reflect.Value) (shouldContinue bool) {
+	// omitted last step is checked before the path is built
+	if n := len(steps); n > 0 && steps[n-1].idx < 0 && df.omitPaths[steps[n-1].name] {
+		return true
 	}
-	wfn := func(path string, reason Reason, leftV reflect.Value, rightV reflect.Value) (shouldContinue bool) {
-		if d.isOmit(path) {
+	if df.fn == nil {
+		if df.hasOmit() && df.isOmit(buildPath(steps)) {
 			return true
 		}
-		_diff.differenceExist = true
-		_d := buildD(path, reason, leftV, rightV)
-		if t, ok := _diff.getPathToType(path); ok && t.Kind() == reflect.Ptr {
-			if leftV.Kind() != reflect.Ptr && leftV.Kind() != reflect.Interface && leftV.IsValid() {
-				nLeft := reflect.New(t.Elem())
-				nLeft.Elem().Set(leftV)
-				_d.LeftV = nLeft
-			}
-			if rightV.Kind() != reflect.Ptr && rightV.Kind() != reflect.Interface && rightV.IsValid() {
-				nRight := reflect.New(t.Elem())
-				nRight.Elem().Set(rightV)
-				_d.RightV = nRight
-			}
+		df.differenceExist = true
+		return false
+	}
+	path := buildPath(steps)
+	if df.isOmit(path) {
+		return true
+	}
+	if v, ok := df.expandable(reason, leftV, rightV); ok {
+		return df.expand(steps, reason, leftV, rightV, v)
+	}
+	return df.report(steps, path, reason, leftV, rightV)
+}
+
+// report build D of the diff at path and pass it to fn
+func (df *differ) report(steps []pathStep, path string, reason Reason, leftV reflect.Value, rightV reflect.Value) bool {
+	if !df.nested && !df.addDiff() {
+		return false
+	}
+	df.differenceExist = true
+	if df.config.snapshot {
+		leftV, rightV = df.snapshotOf(steps, leftV), df.snapshotOf(steps, rightV)
+	}
+	_d := buildD(path, reason, leftV, rightV)
+	if t := df.declaredType(steps); t != nil && t.Kind() == reflect.Ptr {
+		if leftV.Kind() != reflect.Ptr && leftV.Kind() != reflect.Interface && leftV.IsValid() && leftV.Type().AssignableTo(t.Elem()) {
+			nLeft := reflect.New(t.Elem())
+			nLeft.Elem().Set(leftV)
+			_d.LeftV = nLeft
+		}
+		if rightV.Kind() != reflect.Ptr && rightV.Kind() != reflect.Interface && rightV.IsValid() && rightV.Type().AssignableTo(t.Elem()) {
+			nRight := reflect.New(t.Elem())
+			nRight.Elem().Set(rightV)
+			_d.RightV = nRight
 		}
-		return fn(_d)
 	}
-	_diff.Callback = wfn
-	return _diff
+	return df.fn(_d)
 }
 
 // OmitPath would be skipped by differ, the path can be absolute path .A.B.C or last path step D or slice fuzzy path .A[*].E
 func (df *Differ) OmitPath(list ...string) {
+	df.update(func(c *config) error {
+		c.omitPath(list...)
+		return nil
+	})
+}
+
+func (c *config) omitPath(list ...string) {
 	for _, p := range list {
 		if isPathPrefix(p) {
-			df.omitPrefix[getPathPrefix(p)] = true
+			c.omitPrefix[getPathPrefix(p)] = true
 		} else {
-			df.omitPaths[p] = true
+			c.omitPaths[p] = true
 		}
 	}
 }
 
-func (df *Differ) isOmit(p string) bool {
-	if df.omitPaths[p] {
+func (c *config) hasOmit() bool {
+	return len(c.omitPaths) > 0 || len(c.omitPrefix) > 0
+}
+
+func (c *config) isOmit(p string) bool {
+	if c.omitPaths[p] {
 		return true
 	}
-	if df.omitPaths[LastNodeOfPath(p)] {
+	if c.omitPaths[LastNodeOfPath(p)] {
 		return true
 	}
 	p = replaceSliceIndexToStar(p)
-	if df.omitPaths[p] {
+	if c.omitPaths[p] {
 		return true
 	}
-	for prefix := range df.omitPrefix {
-		if strings.HasPrefix(p, prefix) {
+	for prefix := range c.omitPrefix {
+		if isPrefixOf(prefix, p) {
 			return true
 		}
 	}
 	return false
 }
 
+// isPrefixOf whether p is prefix or under it, e.g. .Item is not prefix of .Items
+func isPrefixOf(prefix, p string) bool {
+	if !strings.HasPrefix(p, prefix) {
+		return false
+	}
+	return len(p) == len(prefix) || p[len(prefix)] == '.' || p[len(prefix)] == '['
+}
+
 // RegistCompareFunc the cmpFunc should be func(left,right customType) bool
 func (df *Differ) RegistCompareFunc(fn interface{}) error {
+	return df.update(func(c *config) error { return c.registCompareFunc(fn) })
+}
+
+func (c *config) registCompareFunc(fn interface{}) error {
 	err := errors.New("the cmpFunc should be func(left,right customType) bool")
 	f := reflect.ValueOf(fn)
 	if f.Type().NumIn() != 2 {
@@ -176,12 +434,16 @@ func (df *Differ) RegistCompareFunc(fn interface{}) error {
 	if f.Type().Out(0) != reflect.TypeOf(true) {
 		return err
 	}
-	df.cmpFuncs[f.Type().In(1)] = f
+	c.cmpFuncs[f.Type().In(1)] = f
 	return nil
 }
 
 // RegistPathCompareFunc the cmpFunc should be func(left,right customType) bool
 func (df *Differ) RegistPathCompareFunc(path string, fn interface{}) error {
+	return df.update(func(c *config) error { return c.registPathCompareFunc(path, fn) })
+}
+
+func (c *config) registPathCompareFunc(path string, fn interface{}) error {
 	err := errors.New("the cmpFunc should be func(left,right customType) bool")
 	f := reflect.ValueOf(fn)
 	if f.Type().NumIn() != 2 {
@@ -196,12 +458,17 @@ func (df *Differ) RegistPathCompareFunc(path string, fn interface{}) error {
 	if f.Type().Out(0) != reflect.TypeOf(true) {
 		return err
 	}
-	df.cmpPathFuncs[buildPathType(path, f.Type().In(0))] = f
+	c.cmpPathFuncs[buildPathType(path, f.Type().In(0))] = f
+	c.pathCmpTypes[f.Type().In(0)] = true
 	return nil
 }
 
 // RegistCompareKindFunc the cmpKindFunc should be func(left,right primitiveKind) bool
 func (df *Differ) RegistCompareKindFunc(fn interface{}) error {
+	return df.update(func(c *config) error { return c.registCompareKindFunc(fn) })
+}
+
+func (c *config) registCompareKindFunc(fn interface{}) error {
 	err := errors.New("the cmpKindFunc should be func(left,right primitiveKind) bool")
 	f := reflect.ValueOf(fn)
 	if f.Type().NumIn() != 2 {
@@ -216,12 +483,17 @@ func (df *Differ) RegistCompareKindFunc(fn interface{}) error {
 	if f.Type().Out(0) != reflect.TypeOf(true) {
 		return err
 	}
-	df.cmpKindFuncs[f.Type().In(0).Kind()] = f
+	c.cmpKindFuncs[f.Type().In(0).Kind()] = f
+	c.customKinds[f.Type().In(0).Kind()] = true
 	return nil
 }
 
 // RegistIDFunc should be func(v cumstomType) (id string)
 func (df *Differ) RegistIDFunc(fn interface{}) error {
+	return df.update(func(c *config) error { return c.registIDFunc(fn) })
+}
+
+func (c *config) registIDFunc(fn interface{}) error {
 	err := errors.New("fn should be func(v cumstomType) (id string)")
 	f := reflect.ValueOf(fn)
 	if f.Type().NumIn() != 1 || f.Type().NumOut() != 1 {
@@ -230,12 +502,16 @@ func (df *Differ) RegistIDFunc(fn interface{}) error {
 	if f.Type().Out(0) != reflect.TypeOf("") {
 		return err
 	}
-	df.typeIDFuncs[f.Type().In(0)] = f
+	c.typeIDFuncs[f.Type().In(0)] = f
 	return nil
 }
 
 // RegistKindIDFunc should be func(v cumstomType) (id string)
 func (df *Differ) RegistKindIDFunc(fn interface{}) error {
+	return df.update(func(c *config) error { return c.registKindIDFunc(fn) })
+}
+
+func (c *config) registKindIDFunc(fn interface{}) error {
 	err := errors.New("fn should be func(v cumstomType) (id string)")
 	f := reflect.ValueOf(fn)
 	if f.Type().NumIn() != 1 || f.Type().NumOut() != 1 {
@@ -244,131 +520,188 @@ func (df *Differ) RegistKindIDFunc(fn interface{}) error {
 	if f.Type().Out(0) != reflect.TypeOf("") {
 		return err
 	}
-	df.kindIDFuncs[f.Type().In(0).Kind()] = f
+	c.kindIDFuncs[f.Type().In(0).Kind()] = f
+	c.customIDKinds[f.Type().In(0).Kind()] = true
 	return nil
 }
 
+// RegistPathIDFunc should be func(v cumstomType) (id string), the path is slice path like .A.B or .A[*].B
+func (df *Differ) RegistPathIDFunc(path string, fn interface{}) error {
+	return df.update(func(c *config) error { return c.registPathIDFunc(path, fn) })
+}
+
+func (c *config) registPathIDFunc(path string, fn interface{}) error {
+	err := errors.New("fn should be func(v cumstomType) (id string)")
+	f := reflect.ValueOf(fn)
+	if f.Type().NumIn() != 1 || f.Type().NumOut() != 1 {
+		return err
+	}
+	if f.Type().Out(0) != reflect.TypeOf("") {
+		return err
+	}
+	c.pathIDFuncs[buildPathType(replaceSliceIndexToStar(path), f.Type().In(0))] = f
+	c.pathIDTypes[f.Type().In(0)] = true
+	return nil
+}
+
+// SetSliceOrdered compare slice elements by position instead of aligning them by identity
+func (df *Differ) SetSliceOrdered(ordered bool) {
+	df.update(func(c *config) error {
+		c.sliceOrdered = ordered
+		return nil
+	})
+}
+
+// SetStructural compare different struct types field by field, fields are matched by name or by the tag set by SetStructuralTag
+func (df *Differ) SetStructural(structural bool) {
+	df.update(func(c *config) error {
+		c.structural = structural
+		return nil
+	})
+}
+
+// SetStructuralTag match fields of different struct types by tag like json, fallback to field name
+func (df *Differ) SetStructuralTag(tag string) {
+	df.update(func(c *config) error {
+		c.structuralTag = tag
+		return nil
+	})
+}
+
+// SetAutoDeref dereference both sides to the same base type when pointer levels are mismatched, e.g. T with *T
+func (df *Differ) SetAutoDeref(autoDeref bool) {
+	df.update(func(c *config) error {
+		c.autoDeref = autoDeref
+		return nil
+	})
+}
+
 /* private constants */
 const (
 	_SPLITTOR = "."
 	_ROOT     = _SPLITTOR
 	_ZERO     = "_ZERO_VALUE_"
+	// _STEPS_CAP is the initial capacity of path steps, the steps are reused by siblings
+	_STEPS_CAP = 32
 )
 
 /* private methods */
 
-func (df *Differ) registDefaultCmpFuncs() {
+func (c *config) registDefaultCmpFuncs() {
 	// kind compare
-	df.RegistCompareKindFunc(CmpBool)
-	df.RegistCompareKindFunc(CmpInt)
-	df.RegistCompareKindFunc(CmpInt8)
-	df.RegistCompareKindFunc(CmpInt16)
-	df.RegistCompareKindFunc(CmpInt32)
-	df.RegistCompareKindFunc(CmpInt64)
-	df.RegistCompareKindFunc(CmpUint)
-	df.RegistCompareKindFunc(CmpUint8)
-	df.RegistCompareKindFunc(CmpUint16)
-	df.RegistCompareKindFunc(CmpUint32)
-	df.RegistCompareKindFunc(CmpUint64)
-	df.RegistCompareKindFunc(CmpUintptr)
-	df.RegistCompareKindFunc(CmpFloat32)
-	df.RegistCompareKindFunc(CmpFloat64)
-	df.RegistCompareKindFunc(CmpString)
-	df.RegistCompareKindFunc(CmpUnsafePointer)
-
-	df.RegistCompareFunc(CmpTime)
-	df.RegistCompareFunc(CmpTimePtr)
-
-	df.RegistKindIDFunc(IDOfBool)
-	df.RegistKindIDFunc(IDOfInt)
-	df.RegistKindIDFunc(IDOfInt8)
-	df.RegistKindIDFunc(IDOfInt16)
-	df.RegistKindIDFunc(IDOfInt32)
-	df.RegistKindIDFunc(IDOfInt64)
-	df.RegistKindIDFunc(IDOfUint)
-	df.RegistKindIDFunc(IDOfUint8)
-	df.RegistKindIDFunc(IDOfUint16)
-	df.RegistKindIDFunc(IDOfUint32)
-	df.RegistKindIDFunc(IDOfUint64)
-	df.RegistKindIDFunc(IDOfUintptr)
-	df.RegistKindIDFunc(IDOfString)
-	df.RegistKindIDFunc(IDOfFloat32)
-	df.RegistKindIDFunc(IDOfFloat64)
-}
-
-func (df *Differ) canCmpType(path string, t reflect.Type) bool {
-	_, ok := df.cmpFuncs[t]
-	_, ok1 := df.cmpPathFuncs[buildPathType(path, t)]
-	return ok || ok1
-}
-
-func (df *Differ) getCmpTypeFn(path string, t reflect.Type) reflect.Value {
-	if fn, ok := df.cmpPathFuncs[buildPathType(path, t)]; ok {
-		return fn
-	}
-	return df.cmpFuncs[t]
-}
-
-func (df *differ) setPathToType(path string, tp reflect.Type) {
-	path = replaceSliceIndexToStar(path)
-	if _, ok := df.pathToType[path]; ok {
-		return
-	}
-	df.pathToType[path] = tp
-}
-
-func (df *differ) forceSetPathToType(path string, tp reflect.Type) {
-	path = replaceSliceIndexToStar(path)
-	df.pathToType[path] = tp
-}
-
-func (df *differ) getPathToType(path string) (reflect.Type, bool) {
-	path = replaceSliceIndexToStar(path)
-	t, ok := df.pathToType[path]
-	return t, ok
-}
-
-func (df *differ) cmpByType(steps []string, t reflect.Type, lv, rv reflect.Value) bool {
-	fn := df.getCmpTypeFn(buildPath(steps), t)
+	c.registCompareKindFunc(CmpBool)
+	c.registCompareKindFunc(CmpInt)
+	c.registCompareKindFunc(CmpInt8)
+	c.registCompareKindFunc(CmpInt16)
+	c.registCompareKindFunc(CmpInt32)
+	c.registCompareKindFunc(CmpInt64)
+	c.registCompareKindFunc(CmpUint)
+	c.registCompareKindFunc(CmpUint8)
+	c.registCompareKindFunc(CmpUint16)
+	c.registCompareKindFunc(CmpUint32)
+	c.registCompareKindFunc(CmpUint64)
+	c.registCompareKindFunc(CmpUintptr)
+	c.registCompareKindFunc(CmpFloat32)
+	c.registCompareKindFunc(CmpFloat64)
+	c.registCompareKindFunc(CmpString)
+	c.registCompareKindFunc(CmpUnsafePointer)
+	// the default kind funcs are compared directly without reflect call
+	c.customKinds = make(map[reflect.Kind]bool)
+
+	c.registCompareFunc(CmpTime)
+	c.registCompareFunc(CmpTimePtr)
+
+	c.registKindIDFunc(IDOfBool)
+	c.registKindIDFunc(IDOfInt)
+	c.registKindIDFunc(IDOfInt8)
+	c.registKindIDFunc(IDOfInt16)
+	c.registKindIDFunc(IDOfInt32)
+	c.registKindIDFunc(IDOfInt64)
+	c.registKindIDFunc(IDOfUint)
+	c.registKindIDFunc(IDOfUint8)
+	c.registKindIDFunc(IDOfUint16)
+	c.registKindIDFunc(IDOfUint32)
+	c.registKindIDFunc(IDOfUint64)
+	c.registKindIDFunc(IDOfUintptr)
+	c.registKindIDFunc(IDOfString)
+	c.registKindIDFunc(IDOfFloat32)
+	c.registKindIDFunc(IDOfFloat64)
+	c.customIDKinds = make(map[reflect.Kind]bool)
+}
+
+// cmpTypeFn the path is built only when there are path compare funcs of the type
+func (c *config) cmpTypeFn(steps []pathStep, t reflect.Type) (reflect.Value, bool) {
+	if c.pathCmpTypes[t] {
+		if fn, ok := c.cmpPathFuncs[buildPathType(buildPath(steps), t)]; ok {
+			return fn, true
+		}
+	}
+	fn, ok := c.cmpFuncs[t]
+	return fn, ok
+}
+
+// setDeclaredType override the type of current path, e.g. the dynamic type of interface
+func (df *differ) setDeclaredType(steps []pathStep, t reflect.Type) {
+	if len(steps) == 0 {
+		df.rootType = t
+	} else {
+		steps[len(steps)-1].t = t
+	}
+}
+
+func (df *differ) declaredType(steps []pathStep) reflect.Type {
+	if len(steps) == 0 {
+		return df.rootType
+	}
+	return steps[len(steps)-1].t
+}
+
+func (df *differ) cmpByType(steps []pathStep, fn reflect.Value, lv, rv reflect.Value) bool {
 	if !lv.IsValid() || !rv.IsValid() {
 		if !lv.IsValid() && rv.IsValid() {
-			return df.Callback(buildPath(steps), DiffOfLeftNoValue, lv, rv)
+			return df.Callback(steps, DiffOfLeftNoValue, lv, rv)
 		} else if lv.IsValid() && !rv.IsValid() {
-			return df.Callback(buildPath(steps), DiffOfRightNoValue, lv, rv)
+			return df.Callback(steps, DiffOfRightNoValue, lv, rv)
 		}
 		return true
 	}
 	out := fn.Call([]reflect.Value{lv, rv})
 	equal := out[0].Bool()
 	if !equal {
-		return df.Callback(buildPath(steps), DiffOfValue, lv, rv)
+		return df.Callback(steps, DiffOfValue, lv, rv)
 	}
 	return true
 }
 
-func (df *differ) cmpByKind(steps []string, kind reflect.Kind, lk, rk reflect.Value) bool {
-	fn := df.cmpKindFuncs[kind]
+func (df *differ) cmpByKind(steps []pathStep, kind reflect.Kind, lk, rk reflect.Value) bool {
 	if !lk.IsValid() || !rk.IsValid() {
 		if !lk.IsValid() && rk.IsValid() {
-			return df.Callback(buildPath(steps), DiffOfLeftNoValue, lk, rk)
+			return df.Callback(steps, DiffOfLeftNoValue, lk, rk)
 		} else if lk.IsValid() && !rk.IsValid() {
-			return df.Callback(buildPath(steps), DiffOfRightNoValue, lk, rk)
+			return df.Callback(steps, DiffOfRightNoValue, lk, rk)
 		}
 		return true
 	}
-	out := fn.Call([]reflect.Value{lk.Convert(fn.Type().In(0)), rk.Convert(fn.Type().In(0))})
-	equal := out[0].Bool()
+	var equal bool
+	if df.customKinds[kind] {
+		fn := df.cmpKindFuncs[kind]
+		out := fn.Call([]reflect.Value{lk.Convert(fn.Type().In(0)), rk.Convert(fn.Type().In(0))})
+		equal = out[0].Bool()
+	} else {
+		equal = equalByKind(kind, lk, rk)
+	}
 	if !equal {
-		return df.Callback(buildPath(steps), DiffOfValue, lk, rk)
+		return df.Callback(steps, DiffOfValue, lk, rk)
 	}
 	return true
 }
 
-func cmpVal(df *differ, steps []string, t reflect.Type, lv, rv reflect.Value) bool {
-	df.setPathToType(buildPath(steps), t)
-
-	if df.canCmpType(buildPath(steps), t) {
-		return df.cmpByType(steps, t, lv, rv)
+func cmpVal(df *differ, steps []pathStep, t reflect.Type, lv, rv reflect.Value) bool {
+	if !df.enter(steps) {
+		return false
+	}
+	if fn, ok := df.cmpTypeFn(steps, t); ok {
+		return df.cmpByType(steps, fn, lv, rv)
 	}
 	switch t.Kind() {
 	case reflect.String:
@@ -384,26 +717,36 @@ func cmpVal(df *differ, steps []string, t reflect.Type, lv, rv reflect.Value) bo
 	case reflect.Struct:
 		return cmpStruct(df, steps, t, lv, rv)
 	case reflect.Ptr:
-		if !lv.IsNil() && !lv.IsNil() {
+		if !lv.IsNil() && !rv.IsNil() {
 			return cmpVal(df, steps, t.Elem(), lv.Elem(), rv.Elem())
 		} else if lv.IsNil() && !rv.IsNil() {
-			return df.Callback(buildPath(steps), DiffOfLeftNoValue, lv, rv)
+			return df.Callback(steps, DiffOfLeftNoValue, lv, rv)
 		} else if !lv.IsNil() && rv.IsNil() {
-			return df.Callback(buildPath(steps), DiffOfRightNoValue, lv, rv)
+			return df.Callback(steps, DiffOfRightNoValue, lv, rv)
 		}
 	case reflect.Map:
 		if lv.Type() != rv.Type() {
-			return df.Callback(buildPath(steps), DiffOfType, lv, rv)
+			return df.Callback(steps, DiffOfType, lv, rv)
 		}
-		if !lv.IsNil() && !lv.IsNil() {
-			return cmpMap(df, steps, t.Key(), t.Elem(), lv, rv)
+		if !lv.IsNil() && !rv.IsNil() {
+			if df.plainContainer() {
+				return cmpMap(df, steps, t.Key(), t.Elem(), lv, rv)
+			}
+			return cmpContainer(df, steps, DiffOfMapLength, lv, rv, func(df *differ) bool {
+				return cmpMap(df, steps, t.Key(), t.Elem(), lv, rv)
+			})
 		} else if lv.IsNil() && !rv.IsNil() {
-			return df.Callback(buildPath(steps), DiffOfLeftNoValue, lv, rv)
+			return df.Callback(steps, DiffOfLeftNoValue, lv, rv)
 		} else if !lv.IsNil() && rv.IsNil() {
-			return df.Callback(buildPath(steps), DiffOfRightNoValue, lv, rv)
+			return df.Callback(steps, DiffOfRightNoValue, lv, rv)
 		}
 	case reflect.Slice, reflect.Array:
-		return cmpSlice(df, steps, t.Elem(), lv, rv)
+		if df.plainContainer() {
+			return cmpSlice(df, steps, t.Elem(), lv, rv)
+		}
+		return cmpContainer(df, steps, DiffOfSliceLength, lv, rv, func(df *differ) bool {
+			return cmpSlice(df, steps, t.Elem(), lv, rv)
+		})
 	case reflect.Chan, reflect.Func:
 		return true
 	case reflect.UnsafePointer:
@@ -413,19 +756,21 @@ func cmpVal(df *differ, steps []string, t reflect.Type, lv, rv reflect.Value) bo
 			if lv.IsNil() {
 				return true
 			}
-			df.forceSetPathToType(buildPath(steps), lv.Elem().Type())
-			if lv.Elem().Kind() == reflect.Ptr {
-				return cmpVal(df, steps, lv.Elem().Elem().Type(), lv.Elem().Elem(), rv.Elem().Elem())
-			} else {
-				return cmpVal(df, steps, lv.Elem().Type(), lv.Elem(), rv.Elem())
+			if lv.Elem().Type() != rv.Elem().Type() {
+				if df.canCmpMixed(lv.Elem().Type(), rv.Elem().Type()) {
+					return cmpMixed(df, steps, lv, rv)
+				}
+				return df.Callback(steps, DiffOfType, lv, rv)
 			}
+			df.setDeclaredType(steps, lv.Elem().Type())
+			return cmpVal(df, steps, lv.Elem().Type(), lv.Elem(), rv.Elem())
 		} else {
 			if lv.IsNil() && !rv.IsNil() {
-				df.forceSetPathToType(buildPath(steps), lv.Elem().Type())
-				return df.Callback(buildPath(steps), DiffOfLeftNoValue, lv, rv)
+				df.setDeclaredType(steps, rv.Elem().Type())
+				return df.Callback(steps, DiffOfLeftNoValue, lv, rv)
 			} else if !lv.IsNil() && rv.IsNil() {
-				df.forceSetPathToType(buildPath(steps), lv.Elem().Type())
-				return df.Callback(buildPath(steps), DiffOfRightNoValue, lv, rv)
+				df.setDeclaredType(steps, lv.Elem().Type())
+				return df.Callback(steps, DiffOfRightNoValue, lv, rv)
 			}
 		}
 	}
@@ -1,34 +1,66 @@
 package diff
 
 import (
+	"context"
 	"reflect"
 )
 
-// CompareValue whether equal
+// defaultDiffer is shared by CompareValue, a Differ is safe for concurrent use
+var defaultDiffer = New()
+
+// CompareValue whether equal, it's the equality check mode of Compare with nil callback.
+// Comparing structs, pointers and primitives does not allocate, a slice allocates its identity index
+// unless compared in order and a map allocates its key iterator.
 func CompareValue(l, r interface{}) bool {
-	df := New()
-	return df.Compare(l, r, nil)
+	return defaultDiffer.Compare(l, r, nil)
 }
 
-// Compare with callback
+// Compare with callback, nil callback means equality check only, no path or D is built.
+// It's not equal when a limit like MaxNodes is hit, see CompareContext for the reason.
 func (df *Differ) Compare(l interface{}, r interface{}, fn Callback) (equal bool) {
-	if fn == nil {
-		fn = func(*D) bool { return false }
-	}
+	equal, _ = df.compare(context.Background(), l, r, fn)
+	return
+}
+
+func (df *Differ) compare(ctx context.Context, l interface{}, r interface{}, fn Callback) (equal bool, err error) {
 	lv, rv := reflect.ValueOf(l), reflect.ValueOf(r)
+	if !lv.IsValid() || !rv.IsValid() {
+		if lv.IsValid() == rv.IsValid() {
+			return true, nil
+		}
+		if fn == nil {
+			return false, nil
+		}
+		if !lv.IsValid() {
+			fn(buildD(_ROOT, DiffOfLeftNoValue, lv, rv))
+		} else {
+			fn(buildD(_ROOT, DiffOfRightNoValue, lv, rv))
+		}
+		return
+	}
 	lt, rt := lv.Type(), rv.Type()
-	if lt != rt {
-		fn(buildD(_ROOT, DiffOfType, lv, rv))
+	_differ := acquireDiffer(df, fn)
+	defer releaseDiffer(_differ)
+	_differ.rootType = lt
+	_differ.budget = newBudget(ctx, _differ.config)
+	if lt != rt && !_differ.canCmpMixed(lt, rt) {
+		if fn != nil {
+			fn(buildD(_ROOT, DiffOfType, lv, rv))
+		}
 		return
 	}
-	_differ := newDiffer(df, fn)
-	cmpVal(_differ, []string{}, lt, lv, rv)
-	return !_differ.differenceExist
+	if lt != rt {
+		cmpMixed(_differ, _differ.steps, lv, rv)
+	} else {
+		cmpVal(_differ, _differ.steps, lt, lv, rv)
+	}
+	err = _differ.stopErr()
+	return !_differ.differenceExist && err == nil, err
 }
 
 // MakePatch of l and  r
 func (df *Differ) MakePatch(l interface{}, r interface{}) Patch {
-	var patch Patch
+	patch := Patch{differ: df, rootType: reflect.TypeOf(l)}
 	fn := func(_d *D) bool {
 		patch.add(_d)
 		return true
@@ -0,0 +1,89 @@
+package diff
+
+import (
+	"reflect"
+)
+
+// WithExpandSubtrees report a subtree added or removed as a whole, e.g. a pointer from nil to a struct,
+// by one row per leaf with the absent side as zero. Nil and empty values in the subtree have no row,
+// the subtree is reported as a whole if it has no leaf.
+func WithExpandSubtrees(expand bool) Option {
+	return func(c *config) {
+		c.expandSubtrees = expand
+	}
+}
+
+// expandable whether the row should be expanded into rows of leaves
+func (df *differ) expandable(reason Reason, lv, rv reflect.Value) (reflect.Value, bool) {
+	if !df.expandSubtrees {
+		return reflect.Value{}, false
+	}
+	switch reason {
+	case DiffOfLeftNoValue:
+		return rv, isContainer(rv)
+	case DiffOfRightNoValue:
+		return lv, isContainer(lv)
+	}
+	return reflect.Value{}, false
+}
+
+// expand report leaves of the present value v of a subtree, or the row of lv and rv if there is no leaf
+func (df *differ) expand(steps []pathStep, reason Reason, lv, rv, v reflect.Value) bool {
+	var leaves int
+	if !df.expandNode(steps, reason, v, &leaves) {
+		return false
+	}
+	if leaves == 0 {
+		return df.report(steps, buildPath(steps), reason, lv, rv)
+	}
+	return true
+}
+
+// expandNode walk v and report its leaves, children are counted by the budget like cmpVal
+func (df *differ) expandNode(steps []pathStep, reason Reason, v reflect.Value, leaves *int) bool {
+	if v = indirectValue(v); !v.IsValid() {
+		return true
+	}
+	t := v.Type()
+	child := func(s []pathStep, cv reflect.Value) bool {
+		return df.enter(s) && df.expandNode(s, reason, cv, leaves)
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		if !hasExportedField(t) {
+			break
+		}
+		for i := 0; i < t.NumField(); i++ {
+			if ft := t.Field(i); isExported(ft.Name) {
+				if !child(appendPath(steps, fieldStep(ft.Name, ft.Type)), v.Field(i)) {
+					return false
+				}
+			}
+		}
+		return true
+	case reflect.Map:
+		for _, key := range sortMapKeys(v.MapKeys()) {
+			if !child(appendPath(steps, fieldStep(key.String(), t.Elem())), v.MapIndex(key)) {
+				return false
+			}
+		}
+		return true
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if !child(appendPath(steps, indexStep(i, t.Elem())), v.Index(i)) {
+				return false
+			}
+		}
+		return true
+	}
+	// omitted leaves are counted, so the subtree is not reported as a whole
+	*leaves++
+	path := buildPath(steps)
+	if df.isOmit(path) {
+		return true
+	}
+	if reason == DiffOfLeftNoValue {
+		return df.report(steps, path, reason, reflect.Zero(t), v)
+	}
+	return df.report(steps, path, reason, v, reflect.Zero(t))
+}
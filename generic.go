@@ -0,0 +1,38 @@
+package diff
+
+// Diff make patch of l and r
+func Diff[T any](df *Differ, l, r T) Patch {
+	return df.MakePatch(l, r)
+}
+
+// Equal whether l equals r
+func Equal[T any](df *Differ, l, r T) bool {
+	return df.Compare(l, r, nil)
+}
+
+// RegisterCompare is the type safe RegistCompareFunc
+func RegisterCompare[T any](df *Differ, fn func(l, r T) bool) {
+	mustRegist(df.RegistCompareFunc(fn))
+}
+
+// RegisterPathCompare is the type safe RegistPathCompareFunc
+func RegisterPathCompare[T any](df *Differ, path string, fn func(l, r T) bool) {
+	mustRegist(df.RegistPathCompareFunc(path, fn))
+}
+
+// RegisterID is the type safe RegistIDFunc
+func RegisterID[T any](df *Differ, fn func(T) string) {
+	mustRegist(df.RegistIDFunc(fn))
+}
+
+// RegisterPathID is the type safe RegistPathIDFunc
+func RegisterPathID[T any](df *Differ, path string, fn func(T) string) {
+	mustRegist(df.RegistPathIDFunc(path, fn))
+}
+
+// mustRegist the signature is checked by compiler, so error is a bug
+func mustRegist(err error) {
+	if err != nil {
+		panic(err)
+	}
+}
@@ -1,3 +1,3 @@
 module github.com/qjpcpu/diff
 
-go 1.12
+go 1.23
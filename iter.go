@@ -0,0 +1,27 @@
+package diff
+
+import (
+	"context"
+	"iter"
+)
+
+// Diffs iterate differences of l and r, the traversal stops when the loop breaks
+func (df *Differ) Diffs(l interface{}, r interface{}) iter.Seq[*D] {
+	return func(yield func(*D) bool) {
+		df.Compare(l, r, yield)
+	}
+}
+
+// DiffsContext is Diffs which stops when ctx is done or a limit is hit, the error is yielded with nil D at last
+func (df *Differ) DiffsContext(ctx context.Context, l interface{}, r interface{}) iter.Seq2[*D, error] {
+	return func(yield func(*D, error) bool) {
+		var stopped bool
+		_, err := df.compare(ctx, l, r, func(d *D) bool {
+			stopped = !yield(d, nil)
+			return !stopped
+		})
+		if err != nil && !stopped {
+			yield(nil, err)
+		}
+	}
+}
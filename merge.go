@@ -0,0 +1,345 @@
+package diff
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+)
+
+// Conflict both ours and theirs changed the path to different values, invalid value means no value
+type Conflict struct {
+	Path   string
+	Base   reflect.Value
+	Ours   reflect.Value
+	Theirs reflect.Value
+
+	steps []pathStep
+	m     *merger
+}
+
+// Conflicts of merge
+type Conflicts struct {
+	List []*Conflict
+}
+
+// Size of conflicts
+func (c *Conflicts) Size() int {
+	return len(c.List)
+}
+
+// IsEmpty conflicts
+func (c *Conflicts) IsEmpty() bool {
+	return c.Size() == 0
+}
+
+// Merge3 merge changes of ours and theirs from base into out, which is a pointer to the type of base.
+// Both sides changed the same path to different values is a conflict, it's resolved by the resolvers of path or type,
+// conflicts can't be resolved are returned and ours is taken for them.
+// Slice elements are matched by identity like MakePatch, inputs are not changed.
+func (df *Differ) Merge3(base, ours, theirs, out interface{}) (Conflicts, error) {
+	bv, ov, tv := reflect.ValueOf(base), reflect.ValueOf(ours), reflect.ValueOf(theirs)
+	if !bv.IsValid() || !ov.IsValid() || !tv.IsValid() {
+		return Conflicts{}, errors.New("merge3: nil input")
+	}
+	t := bv.Type()
+	if ov.Type() != t || tv.Type() != t {
+		return Conflicts{}, fmt.Errorf("merge3: types of base, ours and theirs are different: %v, %v, %v", t, ov.Type(), tv.Type())
+	}
+	outV := reflect.ValueOf(out)
+	if !outV.IsValid() || outV.Kind() != reflect.Ptr || outV.IsNil() || outV.Type().Elem() != t {
+		return Conflicts{}, fmt.Errorf("merge3: out should be a non-nil *%v", t)
+	}
+	m := merger{df: acquireDiffer(df, nil), ours: ov, theirs: tv}
+	defer releaseDiffer(m.df)
+	m.df.rootType = t
+	m.oursChanges, m.theirsChanges = changesOf(df, t, bv, ov), changesOf(df, t, bv, tv)
+	merged := m.merge(m.df.steps, t, bv, ov, tv)
+	cl := cloner{config: &config{}}
+	outV.Elem().Set(cl.clone(nil, merged))
+	return m.conflicts, nil
+}
+
+// merger merge values recursively, the differ is in equality mode
+type merger struct {
+	df            *differ
+	ours          reflect.Value
+	theirs        reflect.Value
+	oursChanges   *changeSet
+	theirsChanges *changeSet
+	conflicts     Conflicts
+}
+
+// changeSet paths changed by one side, so subtrees are not compared again at every level of merge
+type changeSet struct {
+	// rows are paths of differences
+	rows map[string]bool
+	// dirty are paths of differences and their parents
+	dirty map[string]bool
+	// blind is the number of merged rows above the current path, children of a row like collapsed container are unknown
+	blind int
+}
+
+// changesOf compare base with one side once
+func changesOf(df *Differ, t reflect.Type, b, v reflect.Value) *changeSet {
+	cs := &changeSet{rows: make(map[string]bool), dirty: make(map[string]bool)}
+	_differ := acquireDiffer(df, func(d *D) bool {
+		cs.rows[d.Path] = true
+		cs.dirty[_ROOT] = true
+		var prefix string
+		for rest := d.Path; rest != "" && rest != _ROOT; {
+			var token string
+			token, rest = nextPathToken(rest)
+			prefix += token
+			cs.dirty[prefix] = true
+		}
+		return true
+	})
+	defer releaseDiffer(_differ)
+	_differ.rootType = t
+	cmpVal(_differ, _differ.steps, t, b, v)
+	return cs
+}
+
+// changed whether v is not base at path
+func (m *merger) changed(cs *changeSet, steps []pathStep, t reflect.Type, b, v reflect.Value) bool {
+	if !b.IsValid() || !v.IsValid() || cs.blind > 0 {
+		return !m.equal(steps, t, b, v)
+	}
+	return cs.dirty[pathOfSteps(steps)]
+}
+
+func pathOfSteps(steps []pathStep) string {
+	if len(steps) == 0 {
+		return _ROOT
+	}
+	return buildPath(steps)
+}
+
+func (m *merger) equal(steps []pathStep, t reflect.Type, a, b reflect.Value) bool {
+	if !a.IsValid() || !b.IsValid() {
+		return a.IsValid() == b.IsValid()
+	}
+	m.df.differenceExist = false
+	cmpVal(m.df, steps, t, a, b)
+	return !m.df.differenceExist
+}
+
+func (m *merger) conflict(steps []pathStep, b, o, th reflect.Value) reflect.Value {
+	m.conflicts.List = append(m.conflicts.List, &Conflict{Path: buildPath(steps), Base: b, Ours: o, Theirs: th})
+	return o
+}
+
+// merge three values of type t, invalid value means no value, so invalid result means deleted
+func (m *merger) merge(steps []pathStep, t reflect.Type, b, o, th reflect.Value) reflect.Value {
+	if !m.changed(m.oursChanges, steps, t, b, o) {
+		return th
+	}
+	if !m.changed(m.theirsChanges, steps, t, b, th) {
+		return o
+	}
+	r := m.df.resolverOf(steps, t)
+	// same changes of both sides are merged by children, values can't be merged by children are compared as a whole
+	if (r != nil || !descendable(t, b, o, th)) && m.equal(steps, t, o, th) {
+		return o
+	}
+	if r != nil {
+		c := &Conflict{Path: buildPath(steps), Base: b, Ours: o, Theirs: th, steps: steps, m: m}
+		if v, ok := r(c); ok && (!v.IsValid() || v.Type().AssignableTo(t)) {
+			return v
+		}
+	}
+	if !b.IsValid() || !o.IsValid() || !th.IsValid() {
+		return m.conflict(steps, b, o, th)
+	}
+	path := pathOfSteps(steps)
+	for _, cs := range []*changeSet{m.oursChanges, m.theirsChanges} {
+		if cs.rows[path] {
+			cs.blind++
+			defer func(cs *changeSet) { cs.blind-- }(cs)
+		}
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		if b.IsNil() || o.IsNil() || th.IsNil() {
+			break
+		}
+		nv := reflect.New(t.Elem())
+		nv.Elem().Set(m.merge(steps, t.Elem(), b.Elem(), o.Elem(), th.Elem()))
+		return nv
+	case reflect.Interface:
+		if b.IsNil() || o.IsNil() || th.IsNil() || b.Elem().Type() != o.Elem().Type() || o.Elem().Type() != th.Elem().Type() {
+			break
+		}
+		nv := reflect.New(t).Elem()
+		nv.Set(m.merge(steps, o.Elem().Type(), b.Elem(), o.Elem(), th.Elem()))
+		return nv
+	case reflect.Struct:
+		if !hasExportedField(t) {
+			break
+		}
+		nv := reflect.New(t).Elem()
+		nv.Set(o)
+		for i := 0; i < t.NumField(); i++ {
+			ft := t.Field(i)
+			if !isExported(ft.Name) {
+				continue
+			}
+			s := appendPath(steps, fieldStep(ft.Name, ft.Type))
+			nv.Field(i).Set(m.merge(s, ft.Type, b.Field(i), o.Field(i), th.Field(i)))
+		}
+		return nv
+	case reflect.Array:
+		nv := reflect.New(t).Elem()
+		for i := 0; i < t.Len(); i++ {
+			s := appendPath(steps, indexStep(i, t.Elem()))
+			nv.Index(i).Set(m.merge(s, t.Elem(), b.Index(i), o.Index(i), th.Index(i)))
+		}
+		return nv
+	case reflect.Map:
+		if b.IsNil() || o.IsNil() || th.IsNil() {
+			break
+		}
+		return m.mergeMap(steps, t, b, o, th)
+	case reflect.Slice:
+		if b.IsNil() || o.IsNil() || th.IsNil() {
+			break
+		}
+		return m.mergeSlice(steps, t, b, o, th)
+	}
+	return m.conflict(steps, b, o, th)
+}
+
+// descendable whether values are merged by children
+func descendable(t reflect.Type, b, o, th reflect.Value) bool {
+	if !b.IsValid() || !o.IsValid() || !th.IsValid() {
+		return false
+	}
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Map:
+		return !b.IsNil() && !o.IsNil() && !th.IsNil()
+	case reflect.Interface:
+		return !b.IsNil() && !o.IsNil() && !th.IsNil() && b.Elem().Type() == o.Elem().Type() && o.Elem().Type() == th.Elem().Type()
+	case reflect.Struct:
+		return hasExportedField(t)
+	case reflect.Array:
+		return true
+	}
+	return false
+}
+
+func (m *merger) mergeMap(steps []pathStep, t reflect.Type, b, o, th reflect.Value) reflect.Value {
+	keys := o.MapKeys()
+	for _, v := range []reflect.Value{b, th} {
+		for _, key := range v.MapKeys() {
+			if !o.MapIndex(key).IsValid() {
+				keys = append(keys, key)
+			}
+		}
+	}
+	nv := reflect.MakeMapWithSize(t, len(keys))
+	visited := make(map[interface{}]bool)
+	for _, key := range sortMapKeys(keys) {
+		if visited[key.Interface()] {
+			continue
+		}
+		visited[key.Interface()] = true
+		s := appendPath(steps, fieldStep(key.String(), t.Elem()))
+		if v := m.merge(s, t.Elem(), b.MapIndex(key), o.MapIndex(key), th.MapIndex(key)); v.IsValid() {
+			nv.SetMapIndex(key, v)
+		}
+	}
+	return nv
+}
+
+// sliceMatch matched elements of base and changed slice by the alignment of cmpSlice
+type sliceMatch struct {
+	toChanged map[int]int
+	toBase    map[int]int
+	added     sliceElems
+	deleted   sliceElems
+}
+
+func (m *merger) matchSlice(steps []pathStep, et reflect.Type, b, v reflect.Value) sliceMatch {
+	var left, right, added, deleted sliceElems
+	if m.df.sliceOrdered {
+		left, right, added, deleted = alignSliceByIndex(b.Len(), v.Len())
+		for i := range added {
+			added[i].identity = strconv.Itoa(added[i].idx)
+		}
+	} else {
+		getIDFn := getIDFn(m.df, steps, et)
+		left, right, added, deleted = alignSlice(buildSliceElems(m.df, et, b, getIDFn), buildSliceElems(m.df, et, v, getIDFn))
+	}
+	match := sliceMatch{toChanged: make(map[int]int), toBase: make(map[int]int), added: added, deleted: deleted}
+	for i := range left {
+		match.toChanged[left[i].idx] = right[i].idx
+		match.toBase[right[i].idx] = left[i].idx
+	}
+	return match
+}
+
+func (m *merger) mergeSlice(steps []pathStep, t reflect.Type, b, o, th reflect.Value) reflect.Value {
+	et := t.Elem()
+	om, tm := m.matchSlice(steps, et, b, o), m.matchSlice(steps, et, b, th)
+	elemOf := func(v reflect.Value, i int, ok bool) reflect.Value {
+		if !ok {
+			return reflect.Value{}
+		}
+		return v.Index(i)
+	}
+	// elements added by both sides with the same identity are merged
+	theirsAdded := make(map[string]int)
+	for _, elem := range tm.added {
+		if _, ok := theirsAdded[elem.identity]; !ok {
+			theirsAdded[elem.identity] = elem.idx
+		}
+	}
+	oursAdded := make(map[int]string)
+	for _, elem := range om.added {
+		oursAdded[elem.idx] = elem.identity
+	}
+	mergedTheirs := make(map[int]bool)
+
+	nv := reflect.MakeSlice(t, 0, o.Len())
+	appendElem := func(v reflect.Value) {
+		if v.IsValid() {
+			nv = reflect.Append(nv, v)
+		}
+	}
+	for j := 0; j < o.Len(); j++ {
+		if bi, ok := om.toBase[j]; ok {
+			ti, tok := tm.toChanged[bi]
+			appendElem(m.merge(appendPath(steps, indexStep(bi, et)), et, b.Index(bi), o.Index(j), elemOf(th, ti, tok)))
+			continue
+		}
+		ti, tok := theirsAdded[oursAdded[j]]
+		if tok && !mergedTheirs[ti] {
+			mergedTheirs[ti] = true
+			appendElem(m.merge(appendPath(steps, indexStep(j, et)), et, reflect.Value{}, o.Index(j), th.Index(ti)))
+			continue
+		}
+		appendElem(o.Index(j))
+	}
+	// deleted by ours
+	for _, elem := range om.deleted {
+		ti, tok := tm.toChanged[elem.idx]
+		appendElem(m.merge(appendPath(steps, indexStep(elem.idx, et)), et, b.Index(elem.idx), reflect.Value{}, elemOf(th, ti, tok)))
+	}
+	for _, elem := range tm.added {
+		if !mergedTheirs[elem.idx] {
+			appendElem(th.Index(elem.idx))
+		}
+	}
+	return nv
+}
+
+// hasExportedField structs like time.Time are merged as a whole
+func hasExportedField(t reflect.Type) bool {
+	for i := 0; i < t.NumField(); i++ {
+		if isExported(t.Field(i).Name) {
+			return true
+		}
+	}
+	return false
+}
@@ -1,7 +1,13 @@
 package diff
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"reflect"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -151,3 +157,1258 @@ func TestIsStructWithIDField(t *testing.T) {
 	check(DeepID2{}, "")
 	check(DeepID2{A1: A1{ID: "a1"}}, "a1")
 }
+
+func TestGenericRegister(t *testing.T) {
+	type Inner struct {
+		Num int
+	}
+	type Item struct {
+		Key string
+		Num int
+	}
+	type Outer struct {
+		Inner Inner
+		Items []Item
+		Count int
+	}
+	o1 := Outer{Inner: Inner{Num: 1}, Items: []Item{{Key: "a", Num: 1}, {Key: "b", Num: 2}}, Count: 100}
+	o2 := Outer{Inner: Inner{Num: 2}, Items: []Item{{Key: "b", Num: 2}, {Key: "a", Num: 1}}, Count: 101}
+	df := New()
+	if Equal(df, o1, o2) {
+		t.Fatal("should not equal")
+	}
+	RegisterCompare(df, func(l, r Inner) bool { return l.Num/10 == r.Num/10 })
+	RegisterPathCompare(df, ".Count", func(l, r int) bool { return l/10 == r/10 })
+	RegisterID(df, func(i Item) string { return i.Key })
+	if patch := Diff(df, o1, o2); !patch.IsEmpty() {
+		t.Fatal("should equal", patch.Readable())
+	}
+	RegisterPathID(df, ".Items", func(i Item) string { return "" })
+	if patch := Diff(df, o1, o2); patch.Size() != 4 {
+		t.Fatal("should align by path id", patch.Readable())
+	}
+}
+
+func TestOptions(t *testing.T) {
+	type Item struct {
+		Key  string
+		Name string
+	}
+	type Obj struct {
+		Name  string
+		Age   int
+		Items []Item
+	}
+	o1 := Obj{Name: "a", Age: 1, Items: []Item{{Key: "1", Name: "x"}, {Key: "2", Name: "y"}}}
+	o2 := Obj{Name: "b", Age: 1, Items: []Item{{Key: "2", Name: "y"}, {Key: "1", Name: "x"}}}
+	base := New(WithSliceOrdered(true))
+	if patch := base.MakePatch(o1, o2); patch.Size() != 5 {
+		t.Fatal("bad patch", patch.Readable())
+	}
+	df := base.With(WithOmitPath(".Name"), WithIDFunc(func(i Item) string { return i.Key }), WithSliceOrdered(false))
+	if !df.Compare(o1, o2, nil) {
+		t.Fatal("should equal")
+	}
+	if patch := base.MakePatch(o1, o2); patch.Size() != 5 {
+		t.Fatal("base should not be changed", patch.Readable())
+	}
+	df = df.With(WithoutOmitPath(), WithCompareKindFunc(func(l, r int) bool { return false }))
+	if patch := df.MakePatch(o1, o2); patch.Size() != 2 {
+		t.Fatal("bad patch", patch.Readable())
+	}
+}
+
+func TestConcurrentRegist(t *testing.T) {
+	type Obj struct {
+		Name string
+		Age  int
+	}
+	o1, o2 := Obj{Name: "a", Age: 1}, Obj{Name: "b", Age: 1}
+	df := New()
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				df.MakePatch(o1, o2)
+			}
+		}()
+	}
+	for j := 0; j < 100; j++ {
+		df.OmitPath(".Name")
+		df.RegistCompareFunc(func(l, r Obj) bool { return true })
+	}
+	wg.Wait()
+	if !df.Compare(o1, o2, nil) {
+		t.Fatal("should equal")
+	}
+}
+
+func TestParallel(t *testing.T) {
+	type Item struct {
+		ID    int
+		Name  string
+		Attrs map[string]int
+	}
+	makeItems := func(n int) []*Item {
+		list := make([]*Item, n)
+		for i := range list {
+			list[i] = &Item{ID: i, Name: "item", Attrs: map[string]int{"a": i, "b": i}}
+		}
+		return list
+	}
+	l, r := makeItems(500), makeItems(500)
+	for i := 0; i < len(r); i += 7 {
+		r[i].Name = "changed"
+		r[i].Attrs["b"] = -1
+	}
+	r[3] = nil
+	lm, rm := make(map[string]*Item), make(map[string]*Item)
+	for i := range l {
+		lm[strconv.Itoa(i)], rm[strconv.Itoa(i)] = l[i], r[i]
+	}
+	seq := New()
+	par := New(WithParallelism(4), WithParallelThreshold(10))
+	if p1, p2 := seq.MakePatch(l, r), par.MakePatch(l, r); p1.Size() == 0 || p1.Readable() != p2.Readable() {
+		t.Fatal("parallel patch should be the same", p1.Size(), p2.Size())
+	}
+	for _, pair := range [][2]interface{}{{l, r}, {lm, rm}} {
+		if p1, p2 := seq.MakePatch(pair[0], pair[1]), par.MakePatch(pair[0], pair[1]); p1.Size() != p2.Size() {
+			t.Fatal("parallel patch should be the same", p1.Size(), p2.Size())
+		}
+		if par.Compare(pair[0], pair[1], nil) {
+			t.Fatal("should not equal")
+		}
+		var cnt int
+		par.Compare(pair[0], pair[1], func(*D) bool {
+			cnt++
+			return cnt < 3
+		})
+		if cnt != 3 {
+			t.Fatal("should stop early", cnt)
+		}
+	}
+	if !par.Compare(l, makeItems(500), nil) {
+		t.Fatal("should equal")
+	}
+}
+
+func TestCompareContext(t *testing.T) {
+	type Node struct {
+		Name  string
+		Child *Node
+	}
+	deep := func(n int, name string) *Node {
+		root := &Node{Name: name}
+		for cur := root; n > 0; n-- {
+			cur.Child = &Node{Name: name}
+			cur = cur.Child
+		}
+		return root
+	}
+
+	equal, err := New().CompareContext(context.Background(), deep(10, "a"), deep(10, "a"), nil)
+	if !equal || err != nil {
+		t.Fatal("should equal", err)
+	}
+
+	equal, err = New(MaxDepth(5)).CompareContext(context.Background(), deep(10, "a"), deep(10, "a"), nil)
+	if equal || !errors.Is(err, ErrMaxDepth) {
+		t.Fatal("should hit max depth", err)
+	}
+	if New(MaxDepth(5)).Compare(deep(10, "a"), deep(10, "a"), nil) {
+		t.Fatal("should not be equal when limit hit")
+	}
+
+	_, err = New(MaxNodes(8)).CompareContext(context.Background(), deep(10, "a"), deep(10, "a"), nil)
+	if !errors.Is(err, ErrMaxNodes) {
+		t.Fatal("should hit max nodes", err)
+	}
+
+	patch, err := New(MaxDiffs(3)).MakePatchContext(context.Background(), deep(10, "a"), deep(10, "b"))
+	if !errors.Is(err, ErrMaxDiffs) || patch.Size() != 3 {
+		t.Fatal("should report 3 diffs", err, patch.Size())
+	}
+	patch, err = New(MaxDiffs(11)).MakePatchContext(context.Background(), deep(10, "a"), deep(10, "b"))
+	if err != nil || patch.Size() != 11 {
+		t.Fatal("should report all diffs", err, patch.Size())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = New().CompareContext(ctx, deep(10, "a"), deep(10, "a"), nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatal("should be canceled", err)
+	}
+
+	list := make([]int, 5000)
+	ctx, cancel = context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	<-ctx.Done()
+	_, err = New(WithParallelism(4), WithParallelThreshold(10)).CompareContext(ctx, list, list, nil)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatal("should exceed deadline", err)
+	}
+	_, err = New(WithParallelism(4), WithParallelThreshold(10), MaxNodes(100)).CompareContext(context.Background(), list, list, nil)
+	if !errors.Is(err, ErrMaxNodes) {
+		t.Fatal("should hit max nodes in parallel", err)
+	}
+}
+
+func TestDeterministicOrder(t *testing.T) {
+	type Item struct {
+		Tags map[string]int
+		Refs map[int]string
+	}
+	l, r := Item{Tags: map[string]int{}, Refs: map[int]string{}}, Item{Tags: map[string]int{}, Refs: map[int]string{}}
+	for i := 0; i < 50; i++ {
+		l.Tags["t"+strconv.Itoa(i)] = i
+		r.Tags["t"+strconv.Itoa(i)] = i + 1
+		l.Refs[i] = "x"
+	}
+	for i := 25; i < 75; i++ {
+		r.Refs[i] = "x"
+	}
+	first := New().MakePatch(l, r)
+	readable := first.Readable()
+	for i := 0; i < 10; i++ {
+		p := New().MakePatch(l, r)
+		if p.Readable() != readable {
+			t.Fatal("patch should be deterministic")
+		}
+	}
+	if first.List[0].Path != ".Tags.t0" || first.List[1].Path != ".Tags.t1" || first.List[2].Path != ".Tags.t10" {
+		t.Fatal("map keys should be sorted", first.List[0].Path, first.List[1].Path, first.List[2].Path)
+	}
+	// removed keys 0..24 are followed by added keys 50..74
+	var refs []int
+	for _, d := range first.List {
+		if strings.HasPrefix(d.Path, ".Refs") {
+			refs = append(refs, int(d.Reason))
+		}
+	}
+	if len(refs) != 50 || Reason(refs[0]) != DiffOfRightNoValue || Reason(refs[49]) != DiffOfLeftNoValue {
+		t.Fatal("bad refs order", refs)
+	}
+}
+
+func TestPatchSort(t *testing.T) {
+	var p Patch
+	p.add(&D{Path: ".B[10]", Reason: DiffOfValue})
+	p.add(&D{Path: ".A", Reason: DiffOfLeftNoValue})
+	p.add(&D{Path: ".B[2].C", Reason: DiffOfValue})
+	p.add(&D{Path: ".B", Reason: DiffOfType})
+	paths := func() string {
+		var list []string
+		for _, d := range p.List {
+			list = append(list, d.Path)
+		}
+		return strings.Join(list, " ")
+	}
+	if p.Sort(SortByPath); paths() != ".A .B .B[2].C .B[10]" {
+		t.Fatal("bad path order", paths())
+	}
+	if p.Sort(SortByReason); paths() != ".B .B[2].C .B[10] .A" {
+		t.Fatal("bad reason order", paths())
+	}
+	if p.Sort(SortBySource); paths() != ".B[10] .A .B[2].C .B" {
+		t.Fatal("bad source order", paths())
+	}
+}
+
+func TestSortMapKeys(t *testing.T) {
+	type K struct {
+		A int
+		B string
+	}
+	keys := []reflect.Value{reflect.ValueOf(K{2, "a"}), reflect.ValueOf(K{1, "b"}), reflect.ValueOf(K{1, "a"})}
+	sortMapKeys(keys)
+	if keys[0].Interface() != (K{1, "a"}) || keys[1].Interface() != (K{1, "b"}) || keys[2].Interface() != (K{2, "a"}) {
+		t.Fatal("bad struct key order", keys)
+	}
+	ikeys := []reflect.Value{reflect.ValueOf(10), reflect.ValueOf(-1), reflect.ValueOf(2)}
+	sortMapKeys(ikeys)
+	if ikeys[0].Int() != -1 || ikeys[2].Int() != 10 {
+		t.Fatal("bad int key order", ikeys)
+	}
+	// pointers are ordered by pointed-to values, not by addresses
+	for i := 0; i < 10; i++ {
+		x, y := &K{2, "a"}, &K{1, "a"}
+		pkeys := []reflect.Value{reflect.ValueOf(x), reflect.ValueOf((*K)(nil)), reflect.ValueOf(y)}
+		sortMapKeys(pkeys)
+		if !pkeys[0].IsNil() || pkeys[1].Interface() != y || pkeys[2].Interface() != x {
+			t.Fatal("bad pointer key order", pkeys)
+		}
+	}
+	type node struct{ Next *node }
+	cyclic := &node{}
+	cyclic.Next = cyclic
+	other := &node{Next: cyclic}
+	if c := compareValue(reflect.ValueOf(cyclic), reflect.ValueOf(other)); c == 0 || c != -compareValue(reflect.ValueOf(other), reflect.ValueOf(cyclic)) {
+		t.Fatal("cyclic keys should be ordered")
+	}
+}
+
+func TestDiffs(t *testing.T) {
+	l, r := []int{1, 2, 3, 4}, []int{1, 5, 6, 7}
+	var paths []string
+	for d := range New(WithSliceOrdered(true)).Diffs(l, r) {
+		paths = append(paths, d.Path)
+		if len(paths) == 2 {
+			break
+		}
+	}
+	if strings.Join(paths, " ") != ".[1] .[2]" {
+		t.Fatal("bad diffs", paths)
+	}
+
+	var count int
+	var lastErr error
+	for d, err := range New(WithSliceOrdered(true), MaxDiffs(2)).DiffsContext(context.Background(), l, r) {
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if d.Reason == DiffOfValue {
+			count++
+		}
+	}
+	if count != 2 || !errors.Is(lastErr, ErrMaxDiffs) {
+		t.Fatal("should yield limit error at last", count, lastErr)
+	}
+}
+
+func TestStream(t *testing.T) {
+	l, r := make([]int, 100), make([]int, 100)
+	for i := range r {
+		r[i] = i + 1
+	}
+	differ := New(WithSliceOrdered(true))
+	var count int
+	diffs, errc := differ.Stream(context.Background(), l, r)
+	for d := range diffs {
+		if d.Path != "."+buildIndexStep(count) {
+			t.Fatal("bad order", d.Path)
+		}
+		count++
+	}
+	if count != 100 {
+		t.Fatal("should stream all diffs", count)
+	}
+	if err := <-errc; err != nil {
+		t.Fatal("should be complete", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	diffs, errc = differ.Stream(ctx, l, r)
+	<-diffs
+	cancel()
+	for range diffs {
+	}
+	if err := <-errc; !errors.Is(err, context.Canceled) {
+		t.Fatal("should report cancel", err)
+	}
+
+	diffs, errc = New(WithSliceOrdered(true), MaxDiffs(10)).Stream(context.Background(), l, r)
+	for range diffs {
+	}
+	if err := <-errc; !errors.Is(err, ErrMaxDiffs) {
+		t.Fatal("should report limit", err)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	type Item struct {
+		Name  string
+		Tags  []string
+		Attrs map[string]int
+	}
+	l, r := &Item{Name: "a"}, &Item{Name: "b", Tags: []string{"x"}, Attrs: map[string]int{"k": 1}}
+	live := New().MakePatch(l, r)
+	snap := New(WithSnapshot(true)).MakePatch(l, r)
+	r.Tags[0] = "y"
+	r.Attrs["k"] = 2
+	for _, d := range live.List {
+		if d.Path == ".Tags" && d.RightV.Index(0).String() != "y" {
+			t.Fatal("live value should be changed")
+		}
+	}
+	for _, d := range snap.List {
+		switch d.Path {
+		case ".Tags":
+			if d.RightV.Index(0).String() != "x" {
+				t.Fatal("snapshot should not be changed")
+			}
+		case ".Attrs":
+			if d.RightV.MapIndex(reflect.ValueOf("k")).Int() != 1 {
+				t.Fatal("snapshot should not be changed")
+			}
+		}
+	}
+}
+
+func TestClone(t *testing.T) {
+	type Node struct {
+		Name     string
+		Secret   string
+		Children []*Node
+		Parent   *Node
+		Meta     map[string]interface{}
+		hidden   int
+	}
+	root := &Node{Name: "root", Secret: "s", Meta: map[string]interface{}{"a": []int{1}}, hidden: 3}
+	root.Children = []*Node{{Name: "c", Secret: "s", Parent: root}}
+	cp := Clone(nil, root)
+	if cp == root || cp.Name != "root" || cp.Children[0] == root.Children[0] || cp.Children[0].Name != "c" || cp.hidden != 3 {
+		t.Fatal("bad clone")
+	}
+	if cp.Children[0].Parent != cp {
+		t.Fatal("cycle should be kept")
+	}
+	cp.Meta["a"].([]int)[0] = 2
+	if root.Meta["a"].([]int)[0] != 1 {
+		t.Fatal("should deep copy interface")
+	}
+
+	cp = Clone(New(WithOmitPath("Secret")), root)
+	if cp.Secret != "" || cp.Children[0].Secret != "" || cp.Name != "root" {
+		t.Fatal("omitted path should be zero")
+	}
+}
+
+func TestPatchJSON(t *testing.T) {
+	type Addr struct {
+		City string
+		Zip  int
+	}
+	type User struct {
+		Name  string
+		Age   *int
+		Addrs []Addr
+		Tags  map[string]float64
+		Extra interface{}
+	}
+	age := 3
+	l := User{Name: "a", Addrs: []Addr{{City: "x", Zip: 1}}, Tags: map[string]float64{"k": 1}, Extra: 1}
+	r := User{Name: "b", Age: &age, Addrs: []Addr{{City: "x", Zip: 2}, {City: "y"}}, Tags: map[string]float64{"k": 1.5}, Extra: "s"}
+	differ := New(WithSliceOrdered(true))
+	patch := differ.MakePatch(l, r)
+	data, err := json.Marshal(patch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"reason":"value"`) {
+		t.Fatal("reason should be text", string(data))
+	}
+	loaded, err := UnmarshalPatch(data, User{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Readable() != patch.Readable() {
+		t.Fatal("bad round trip", loaded.Readable(), patch.Readable())
+	}
+	hidden := reflect.ValueOf(struct{ n int }{1}).Field(0)
+	if _, err = json.Marshal(Patch{List: []*D{{Path: ".n", Reason: DiffOfValue, LeftV: hidden, RightV: hidden}}}); err == nil {
+		t.Fatal("value of unexported field should not be marshaled as absent")
+	}
+	for i, d := range loaded.List {
+		origin := patch.List[i]
+		if d.Path != origin.Path || d.Reason != origin.Reason {
+			t.Fatal("bad row", d.Path, origin.Path)
+		}
+		if origin.Reason != DiffOfType && origin.RightV.IsValid() && d.RightV.Type() != origin.RightV.Type() {
+			t.Fatal("bad type", d.Path, d.RightV.Type(), origin.RightV.Type())
+		}
+	}
+
+	var reason Reason
+	if err := reason.UnmarshalText([]byte("no_such")); err == nil {
+		t.Fatal("should fail")
+	}
+	if _, err := UnmarshalPatch([]byte("{"), nil); err == nil {
+		t.Fatal("should fail")
+	}
+}
+
+func TestMerge3(t *testing.T) {
+	type Rule struct {
+		Name  string
+		Limit int
+	}
+	type Config struct {
+		Title  string
+		Owner  string
+		Port   int
+		Rules  []Rule
+		Labels map[string]string
+		Proxy  *Rule
+	}
+	differ := New(WithIDFunc(func(r Rule) string { return r.Name }))
+	base := Config{
+		Title:  "cfg",
+		Port:   80,
+		Rules:  []Rule{{"a", 1}, {"b", 2}, {"c", 3}},
+		Labels: map[string]string{"env": "dev", "team": "x"},
+		Proxy:  &Rule{"p", 1},
+	}
+	ours := Clone(nil, base)
+	ours.Title = "ours"
+	ours.Port = 81
+	ours.Rules[0].Limit = 10
+	ours.Rules = append(ours.Rules, Rule{"d", 4})
+	delete(ours.Labels, "team")
+	ours.Proxy.Limit = 2
+
+	theirs := Clone(nil, base)
+	theirs.Owner = "bob"
+	theirs.Port = 82
+	theirs.Rules = []Rule{{"a", 1}, {"c", 30}, {"e", 5}}
+	theirs.Labels["zone"] = "z"
+	theirs.Proxy.Name = "q"
+
+	var out Config
+	conflicts, err := differ.Merge3(base, ours, theirs, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conflicts.Size() != 1 || conflicts.List[0].Path != ".Port" || conflicts.List[0].Theirs.Int() != 82 {
+		t.Fatal("should conflict on port", conflicts.List)
+	}
+	expect := Config{
+		Title:  "ours",
+		Owner:  "bob",
+		Port:   81,
+		Rules:  []Rule{{"a", 10}, {"c", 30}, {"d", 4}, {"e", 5}},
+		Labels: map[string]string{"env": "dev", "zone": "z"},
+		Proxy:  &Rule{"q", 2},
+	}
+	if patch := differ.MakePatch(expect, out); !patch.IsEmpty() {
+		t.Fatal("bad merge", patch.Readable())
+	}
+	if base.Title != "cfg" || len(base.Labels) != 2 || base.Proxy.Limit != 1 {
+		t.Fatal("base should not be changed")
+	}
+	out.Proxy.Limit = 100
+	if ours.Proxy.Limit != 2 {
+		t.Fatal("out should be a copy")
+	}
+
+	// parent removed while child changed
+	ours = Clone(nil, base)
+	ours.Proxy = nil
+	theirs = Clone(nil, base)
+	theirs.Proxy.Limit = 5
+	conflicts, _ = differ.Merge3(base, ours, theirs, &out)
+	if conflicts.Size() != 1 || conflicts.List[0].Path != ".Proxy" {
+		t.Fatal("should conflict on proxy", conflicts.List)
+	}
+
+	if _, err := differ.Merge3(base, &ours, theirs, &out); err == nil {
+		t.Fatal("should fail on different types")
+	}
+	if _, err := differ.Merge3(base, ours, theirs, out); err == nil {
+		t.Fatal("should fail on non pointer out")
+	}
+
+	// subtrees are compared once instead of at every level
+	type mark struct{ V int }
+	type chain struct {
+		A, B mark
+		Next *chain
+	}
+	var calls int
+	counted := New()
+	RegisterCompare(counted, func(l, r mark) bool {
+		calls++
+		return l == r
+	})
+	build := func(a, b int) *chain {
+		c := &chain{A: mark{a}, B: mark{b}}
+		for i := 0; i < 99; i++ {
+			c = &chain{Next: c}
+		}
+		return c
+	}
+	var merged *chain
+	conflicts, err = counted.Merge3(build(0, 0), build(1, 0), build(0, 1), &merged)
+	if err != nil || !conflicts.IsEmpty() {
+		t.Fatal("bad merge of chain", err, conflicts.List)
+	}
+	for merged.Next != nil {
+		merged = merged.Next
+	}
+	if merged.A.V != 1 || merged.B.V != 1 || calls > 1000 {
+		t.Fatal("bad merge of chain", merged.A, merged.B, calls)
+	}
+	// same changes of both sides
+	conflicts, _ = counted.Merge3(build(0, 0), build(2, 1), build(2, 1), &merged)
+	for merged.Next != nil {
+		merged = merged.Next
+	}
+	if !conflicts.IsEmpty() || merged.A.V != 2 || merged.B.V != 1 {
+		t.Fatal("same changes should not conflict", conflicts.List)
+	}
+}
+
+func TestSetUnion(t *testing.T) {
+	type Doc struct {
+		Tags []string
+	}
+	differ := New(WithPathResolver(".Tags", SetUnion))
+	check := func(base, ours, theirs []string, expect string) {
+		t.Helper()
+		var out Doc
+		conflicts, err := differ.Merge3(Doc{base}, Doc{ours}, Doc{theirs}, &out)
+		if err != nil || !conflicts.IsEmpty() {
+			t.Fatal(err, conflicts.List)
+		}
+		if got := strings.Join(out.Tags, ","); got != expect {
+			t.Fatalf("union should be %s, but get %s", expect, got)
+		}
+	}
+	// b is deleted by ours, d is deleted by theirs
+	check([]string{"a", "b", "c", "d"}, []string{"a", "c", "d", "o"}, []string{"a", "t", "b", "c"}, "a,t,c,o")
+	// elements added by both keep their positions
+	check([]string{"a", "b"}, []string{"o", "a", "b"}, []string{"a", "b", "t"}, "o,a,b,t")
+	check([]string{"a", "b"}, []string{"a", "o", "b"}, []string{"a", "t", "b"}, "a,t,o,b")
+}
+
+func TestMergeResolvers(t *testing.T) {
+	type Stock struct {
+		SKU   string
+		Count int
+	}
+	type Item struct {
+		Name      string
+		Count     int
+		Price     float64
+		Note      string
+		Tags      []string
+		Stocks    []Stock
+		UpdatedAt time.Time
+	}
+	now := time.Now()
+	base := Item{Name: "a", Count: 10, Price: 1, Note: "n", Tags: []string{"x"}, Stocks: []Stock{{"s1", 5}}, UpdatedAt: now}
+	ours := Clone(nil, base)
+	ours.Name, ours.Count, ours.Price, ours.Note = "ours", 12, 2, "ours"
+	ours.Tags = []string{"x", "o"}
+	ours.Stocks[0].Count = 7
+	ours.UpdatedAt = now.Add(time.Minute)
+	theirs := Clone(nil, base)
+	theirs.Name, theirs.Count, theirs.Price, theirs.Note = "theirs", 7, 3, "theirs"
+	theirs.Tags = []string{"t"}
+	theirs.Stocks[0].Count = 4
+	theirs.UpdatedAt = now.Add(time.Hour)
+
+	differ := New(
+		WithIDFunc(func(s Stock) string { return s.SKU }),
+		WithCompareFunc(func(l, r time.Time) bool { return l.Equal(r) }),
+		WithPathResolver(".Count", Sum),
+		WithPathResolver(".Stocks[*].Count", Sum),
+		WithPathResolver("Name", PreferNewest(".UpdatedAt")),
+		WithPathResolver(".Tags", SetUnion),
+		WithResolver[float64](func(c *Conflict) (reflect.Value, bool) {
+			return reflect.ValueOf(c.Ours.Float() * 10), true
+		}),
+	)
+	var out Item
+	conflicts, err := differ.Merge3(base, ours, theirs, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conflicts.Size() != 2 || conflicts.List[0].Path != ".Note" || conflicts.List[1].Path != ".UpdatedAt" {
+		t.Fatal("note and time can't be resolved", conflicts.List)
+	}
+	if out.Count != 9 || out.Stocks[0].Count != 6 || out.Name != "theirs" || out.Price != 20 || out.Note != "ours" {
+		t.Fatal("bad resolved values", out)
+	}
+	if strings.Join(out.Tags, ",") != "t,o" {
+		t.Fatal("x deleted by theirs should be dropped from union", out.Tags)
+	}
+
+	RegisterResolver[string](differ, PreferTheirs)
+	differ.RegistPathResolver(".UpdatedAt", PreferTheirs)
+	differ.RegistPathResolver("Name", PreferOurs)
+	conflicts, _ = differ.Merge3(base, ours, theirs, &out)
+	if !conflicts.IsEmpty() || out.Note != "theirs" || out.Name != "ours" {
+		t.Fatal("path resolver should take precedence", out.Note, out.Name)
+	}
+}
+
+type applyItem struct {
+	ID   int
+	Name string
+}
+
+type applyDoc struct {
+	Title  string
+	Count  int
+	Owner  *applyItem
+	Items  []applyItem
+	Labels map[string]string
+	Attrs  map[string]interface{}
+	Nums   []int
+}
+
+func TestPatchApply(t *testing.T) {
+	differ := New(WithIDFunc(func(i applyItem) string { return strconv.Itoa(i.ID) }))
+	l := applyDoc{
+		Title:  "a",
+		Count:  1,
+		Items:  []applyItem{{1, "x"}, {2, "y"}, {3, "z"}},
+		Labels: map[string]string{"a": "1", "b": "2"},
+		Attrs:  map[string]interface{}{"n": 1.0},
+		Nums:   []int{1, 2, 3},
+	}
+	r := applyDoc{
+		Title:  "b",
+		Owner:  &applyItem{9, "o"},
+		Items:  []applyItem{{1, "xx"}, {3, "z"}, {4, "w"}, {5, "v"}},
+		Labels: map[string]string{"a": "1", "c": "3"},
+		Attrs:  map[string]interface{}{"n": 2.0, "s": "t"},
+		Nums:   []int{3, 1},
+	}
+	patch := differ.MakePatch(l, r)
+	target := Clone(nil, l)
+	if err := patch.Apply(&target); err != nil {
+		t.Fatal(err)
+	}
+	// moves are not recorded by identity, elements keep the order of left
+	if !reflect.DeepEqual(target.Nums, []int{1, 3}) || !reflect.DeepEqual(target.Items, []applyItem{{1, "xx"}, {4, "w"}, {3, "z"}, {5, "v"}}) {
+		t.Fatal("bad order after apply", target.Nums, target.Items)
+	}
+	if p := differ.MakePatch(target, r); !p.IsEmpty() {
+		t.Fatal("should equal right after apply", p.Readable())
+	}
+	if l.Title != "a" || len(l.Items) != 3 {
+		t.Fatal("left should not be changed")
+	}
+	target = Clone(nil, l)
+	ordered := New(WithSliceOrdered(true)).MakePatch(l, r)
+	if err := ordered.Apply(&target); err != nil || !reflect.DeepEqual(target, r) {
+		t.Fatal("ordered patch should keep the order of right", err, target)
+	}
+
+	bad := Patch{List: []*D{{Path: ".NoSuch", Reason: DiffOfValue, RightV: reflect.ValueOf(1)}}}
+	if err := bad.Apply(&target); err == nil {
+		t.Fatal("should fail on unknown path")
+	}
+	if err := patch.Apply(target); err == nil {
+		t.Fatal("should fail on non pointer")
+	}
+}
+
+func TestCompose(t *testing.T) {
+	differ := New(WithIDFunc(func(i applyItem) string { return strconv.Itoa(i.ID) }))
+	v0 := applyDoc{Title: "a", Count: 1, Owner: &applyItem{1, "o"}, Labels: map[string]string{"a": "1"}, Items: []applyItem{{1, "x"}}}
+	v1 := Clone(nil, v0)
+	v1.Title, v1.Count = "b", 2
+	v1.Labels["tmp"] = "t"
+	v1.Owner.Name = "p"
+	v1.Items = append(v1.Items, applyItem{2, "y"})
+	v2 := Clone(nil, v1)
+	v2.Title, v2.Count = "c", 1
+	delete(v2.Labels, "tmp")
+	v2.Owner = nil
+	v2.Items[1].Name = "yy"
+
+	p1, p2 := differ.MakePatch(v0, v1), differ.MakePatch(v1, v2)
+	composed, err := Compose(p1, p2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := Clone(nil, v0)
+	if err := composed.Apply(&target); err != nil {
+		t.Fatal(err)
+	}
+	if p := differ.MakePatch(target, v2); !p.IsEmpty() {
+		t.Fatal("should equal v2", p.Readable())
+	}
+	rows := make(map[string]*D)
+	for _, d := range composed.List {
+		rows[d.Path] = d
+	}
+	if d := rows[".Title"]; d == nil || d.LeftV.String() != "a" || d.RightV.String() != "c" {
+		t.Fatal("title should collapse", composed.Readable())
+	}
+	if rows[".Count"] != nil || rows[".Labels.tmp"] != nil {
+		t.Fatal("cancelled changes should be dropped", composed.Readable())
+	}
+	if d := rows[".Owner"]; d == nil || rows[".Owner.Name"] != nil || reflect.Indirect(d.LeftV).Interface() != (applyItem{1, "o"}) {
+		t.Fatal("owner should restore the left value", composed.Readable())
+	}
+	if d := rows[".Items[1]"]; d == nil || d.Reason != DiffOfRightElemAdded || d.RightV.Interface() != (applyItem{2, "yy"}) {
+		t.Fatal("added item should be updated", composed.Readable())
+	}
+}
+
+func TestComposeSlice(t *testing.T) {
+	differ := New(WithIDFunc(func(i applyItem) string { return strconv.Itoa(i.ID) }))
+	check := func(vs ...[]applyItem) {
+		t.Helper()
+		p1, p2 := differ.MakePatch(vs[0], vs[1]), differ.MakePatch(vs[1], vs[2])
+		composed, err := Compose(p1, p2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		target := Clone(nil, vs[0])
+		if err := composed.Apply(&target); err != nil {
+			t.Fatal(err, composed.Readable())
+		}
+		if !reflect.DeepEqual(target, vs[2]) {
+			t.Fatal("should equal applying p1 then p2", target, composed.Readable())
+		}
+	}
+	a, b, c, d, e := applyItem{1, "a"}, applyItem{2, "b"}, applyItem{3, "c"}, applyItem{4, "d"}, applyItem{5, "e"}
+	// both remove the first element
+	check([]applyItem{a, b, c}, []applyItem{b, c}, []applyItem{c})
+	// both add at the head and the tail
+	check([]applyItem{a}, []applyItem{d, a}, []applyItem{e, d, a, b})
+	// p2 changes elements shifted by p1
+	check([]applyItem{a, b, c}, []applyItem{d, b, c}, []applyItem{d, {2, "bb"}, c, e})
+	// p2 changes and removes elements added by p1
+	check([]applyItem{a, b}, []applyItem{d, a, e, b}, []applyItem{{4, "dd"}, a, b})
+	// p2 removes elements and changes one after them
+	check([]applyItem{a, b, c, d}, []applyItem{a, e, b, c, d}, []applyItem{a, e, {4, "dd"}})
+}
+
+func TestApplyStrict(t *testing.T) {
+	differ := New(
+		WithIDFunc(func(i applyItem) string { return strconv.Itoa(i.ID) }),
+		WithPathCompareFunc(".Title", func(l, r string) bool { return strings.EqualFold(l, r) }),
+	)
+	base := applyDoc{Title: "a", Count: 1, Labels: map[string]string{"a": "1"}, Items: []applyItem{{1, "x"}}}
+	changed := Clone(nil, base)
+	changed.Title, changed.Count = "b", 2
+	changed.Labels["b"] = "2"
+	changed.Items[0].Name = "xx"
+	patch := differ.MakePatch(base, changed)
+
+	current := Clone(nil, base)
+	current.Title = "A"
+	if err := patch.ApplyStrict(&current); err != nil {
+		t.Fatal("title is equal by the rules of differ", err)
+	}
+	if current.Title != "b" || current.Items[0].Name != "xx" || current.Labels["b"] != "2" {
+		t.Fatal("bad apply", current)
+	}
+
+	current = Clone(nil, base)
+	current.Count = 5
+	current.Labels["b"] = "3"
+	err := patch.ApplyStrict(&current)
+	var conflict *ConflictError
+	if !errors.As(err, &conflict) || strings.Join(conflict.Paths, " ") != ".Count .Labels.b" {
+		t.Fatal("should conflict", err)
+	}
+	if current.Title != "a" || current.Count != 5 {
+		t.Fatal("should not apply partially")
+	}
+}
+
+func TestApplyUntyped(t *testing.T) {
+	decode := func(s string) (v map[string]interface{}) {
+		if err := json.Unmarshal([]byte(s), &v); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	l := decode(`{"name":"a","tags":["x","y"],"spec":{"port":80,"env":{"a":"1"}}}`)
+	r := decode(`{"name":"b","tags":["x","y","z"],"spec":{"port":81,"hosts":["h"]},"new":{"k":true}}`)
+	patch := New(WithSliceOrdered(true)).MakePatch(l, r)
+	doc := decode(`{"name":"a","tags":["x","y"],"spec":{"port":80,"env":{"a":"1"}}}`)
+	if err := patch.Apply(&doc); err != nil {
+		t.Fatal(err)
+	}
+	if p := New().MakePatch(doc, r); !p.IsEmpty() {
+		t.Fatal("should equal right", p.Readable())
+	}
+
+	// intermediate nodes are created and arrays grow
+	var empty interface{}
+	grow := Patch{List: []*D{{Path: ".x.y[2]", Reason: DiffOfValue, RightV: reflect.ValueOf(1)}}}
+	if err := grow.Apply(&empty); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := json.Marshal(empty); string(data) != `{"x":{"y":[null,null,1]}}` {
+		t.Fatal("bad grow", string(data))
+	}
+
+	// keys are case sensitive like json
+	doc = decode(`{"Name":1}`)
+	cased := New().MakePatch(doc, decode(`{"Name":1,"name":2}`))
+	if err := cased.Apply(&doc); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := json.Marshal(doc); string(data) != `{"Name":1,"name":2}` {
+		t.Fatal("keys should be case sensitive", string(data))
+	}
+	labels := map[string]string{"Name": "x"}
+	strict := New().MakePatch(labels, map[string]string{"Name": "x", "name": "y"})
+	if err := strict.ApplyStrict(&labels); err != nil || len(labels) != 2 {
+		t.Fatal("keys of typed map should be case sensitive", err, labels)
+	}
+
+	// typed patch on untyped document, fields are named by json tags
+	type Meta struct {
+		Owner string `json:"owner"`
+	}
+	type Spec struct {
+		Port  int      `json:"port"`
+		Hosts []string `json:"hosts,omitempty"`
+		Zone  string
+	}
+	type Config struct {
+		Meta
+		Name string `json:"name"`
+		Spec *Spec  `json:"spec"`
+	}
+	typed := New().MakePatch(Config{Name: "a", Spec: &Spec{}}, Config{Meta: Meta{"o"}, Name: "c", Spec: &Spec{Port: 90, Hosts: []string{"h"}, Zone: "z"}})
+	doc = decode(`{"name":"a","spec":{"port":0}}`)
+	if err := typed.Apply(&doc); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := json.Marshal(doc); string(data) != `{"name":"c","owner":"o","spec":{"Zone":"z","hosts":["h"],"port":90}}` {
+		t.Fatal("bad typed apply", string(data))
+	}
+}
+
+func TestTransform(t *testing.T) {
+	differ := New(WithIDFunc(func(i applyItem) string { return strconv.Itoa(i.ID) }))
+	ordered := New(WithSliceOrdered(true))
+	converge := func(x, xa, xb applyDoc) applyDoc {
+		a, b := differ.MakePatch(x, xa), differ.MakePatch(x, xb)
+		a2, b2 := Transform(a, b)
+		ab, ba := Clone(nil, x), Clone(nil, x)
+		if err := a.Apply(&ab); err != nil {
+			t.Fatal(err)
+		}
+		if err := b2.Apply(&ab); err != nil {
+			t.Fatal(err)
+		}
+		if err := b.Apply(&ba); err != nil {
+			t.Fatal(err)
+		}
+		if err := a2.Apply(&ba); err != nil {
+			t.Fatal(err)
+		}
+		if p := ordered.MakePatch(ab, ba); !p.IsEmpty() {
+			t.Fatal("should converge", p.Readable(), a.Readable(), b2.Readable(), b.Readable(), a2.Readable())
+		}
+		return ab
+	}
+	names := func(items []applyItem) string {
+		var list []string
+		for _, i := range items {
+			list = append(list, i.Name)
+		}
+		return strings.Join(list, ",")
+	}
+
+	x := applyDoc{Title: "t", Items: []applyItem{{1, "a"}, {2, "b"}, {3, "c"}}, Labels: map[string]string{"k": "v"}}
+	xa, xb := Clone(nil, x), Clone(nil, x)
+	xa.Title = "A"
+	xa.Items = []applyItem{{1, "a"}, {4, "d"}, {2, "b"}, {3, "c"}, {6, "f"}}
+	xa.Labels["x"] = "1"
+	xb.Title = "B"
+	xb.Items = []applyItem{{1, "a"}, {3, "cc"}}
+	xb.Labels["y"] = "2"
+	res := converge(x, xa, xb)
+	if res.Title != "A" || names(res.Items) != "a,d,cc,f" || len(res.Labels) != 3 {
+		t.Fatal("bad transform", res)
+	}
+
+	// both add at the same position, a goes first
+	xa, xb = Clone(nil, x), Clone(nil, x)
+	xa.Items = []applyItem{{1, "a"}, {4, "d"}, {2, "b"}, {3, "c"}}
+	xb.Items = []applyItem{{5, "e"}, {1, "a"}, {7, "g"}, {2, "b"}, {3, "c"}}
+	res = converge(x, xa, xb)
+	if names(res.Items) != "e,a,d,g,b,c" {
+		t.Fatal("bad transform", names(res.Items))
+	}
+
+	// change under the path replaced by the other side is merged
+	x.Owner = &applyItem{1, "o"}
+	xa, xb = Clone(nil, x), Clone(nil, x)
+	xa.Owner = nil
+	xb.Owner.Name = "p"
+	res = converge(x, xa, xb)
+	if res.Owner != nil {
+		t.Fatal("removed owner can't be merged", res.Owner)
+	}
+	xa, xb = Clone(nil, x), Clone(nil, x)
+	xa.Attrs = map[string]interface{}{"a": 1}
+	xb.Attrs = map[string]interface{}{"b": 2}
+	res = converge(x, xa, xb)
+	if len(res.Attrs) != 1 || res.Attrs["a"] != 1 {
+		t.Fatal("a wins for the same path", res.Attrs)
+	}
+}
+
+func TestPatchQuery(t *testing.T) {
+	differ := New(WithSliceOrdered(true))
+	l := applyDoc{Title: "a", Count: 1, Items: []applyItem{{1, "x"}, {2, "y"}}, Labels: map[string]string{"k": "v"}}
+	r := applyDoc{Title: "b", Count: 1, Items: []applyItem{{1, "xx"}, {2, "yy"}, {3, "z"}}, Labels: map[string]string{}}
+	patch := differ.MakePatch(l, r)
+
+	paths := func(p Patch) string {
+		var list []string
+		for _, d := range p.List {
+			list = append(list, d.Path)
+		}
+		return strings.Join(list, " ")
+	}
+	if s := patch.Select(".Items[*].Name"); paths(s) != ".Items[0].Name .Items[1].Name" {
+		t.Fatal("bad select", paths(s))
+	}
+	if s := patch.Select(".Items.*"); s.Size() != 3 {
+		t.Fatal("bad prefix select", paths(s))
+	}
+	if s := patch.Exclude("Name"); paths(s) != ".Title .Items[2] .Labels.k" {
+		t.Fatal("bad exclude", paths(s))
+	}
+	if d, ok := patch.Get(".Title"); !ok || d.RightV.String() != "b" {
+		t.Fatal("bad get")
+	}
+	if _, ok := patch.Get(".Count"); ok {
+		t.Fatal("count is not changed")
+	}
+	if !patch.Has(".Labels.*") || patch.Has(".Owner") {
+		t.Fatal("bad has")
+	}
+	if patch.Has(".Item.*") || patch.Has(".Tit.*") || !patch.Has(".Title.*") {
+		t.Fatal("prefix should end at a step boundary")
+	}
+	// patterns match the rows skipped by OmitPath
+	for _, pattern := range []string{".Items", "Name", ".Items[*].Name", ".Items.*", ".Labels.*", ".Title"} {
+		omitted := New(WithSliceOrdered(true), WithOmitPath(pattern)).MakePatch(l, r)
+		if excluded := patch.Exclude(pattern); paths(excluded) != paths(omitted) {
+			t.Fatal("exclude should be the same as OmitPath", pattern, paths(excluded), paths(omitted))
+		}
+	}
+	groups := patch.GroupByPrefix(1)
+	if len(groups) != 3 || len(groups[".Items"].List) != 3 || len(groups[".Title"].List) != 1 {
+		t.Fatal("bad groups", groups)
+	}
+	if groups = patch.GroupByPrefix(2); len(groups[".Items[1]"].List) != 1 {
+		t.Fatal("bad groups of depth 2", groups)
+	}
+	byReason := patch.ByReason()
+	if len(byReason[DiffOfValue].List) != 3 || len(byReason[DiffOfRightElemAdded].List) != 1 || len(byReason[DiffOfRightNoValue].List) != 1 {
+		t.Fatal("bad reasons", byReason)
+	}
+	if f := patch.Filter(func(d *D) bool { return d.Reason == DiffOfValue }); f.Size() != 3 {
+		t.Fatal("bad filter")
+	}
+}
+
+func TestPatchSummary(t *testing.T) {
+	differ := New(WithSliceOrdered(true))
+	l := applyDoc{Title: "a", Items: []applyItem{{1, "x"}, {2, "y"}}, Labels: map[string]string{"k": "v"}}
+	r := applyDoc{Title: "b", Count: 2, Items: []applyItem{{1, "xx"}}, Labels: map[string]string{"n": "v"}}
+	patch := differ.MakePatch(l, r)
+	s := patch.Summary()
+	if s.Changed() != 3 || s.Added() != 1 || s.Removed() != 2 {
+		t.Fatal("bad counts", s)
+	}
+	if s.Fields[".Items"] != 2 || s.Fields[".Labels"] != 2 || s.Containers != 1 || s.Leaves != 5 || s.MaxDepth != 3 {
+		t.Fatal("bad summary", s.Fields, s.Containers, s.Leaves, s.MaxDepth)
+	}
+	if s.String() != "3 changed, 1 added, 2 removed under .Items, .Labels, .Count +1 more" {
+		t.Fatal("bad string", s.String())
+	}
+	var empty Patch
+	if empty.Summary().String() != "no changes" {
+		t.Fatal("bad empty summary")
+	}
+}
+
+func TestContainerRows(t *testing.T) {
+	l := applyDoc{Nums: []int{1, 2, 3}, Labels: map[string]string{"a": "1"}, Items: []applyItem{{1, "x"}, {2, "y"}, {3, "z"}}}
+	r := applyDoc{Nums: []int{1, 2, 3, 4, 5}, Labels: map[string]string{"a": "2", "b": "1"}, Items: []applyItem{{1, "xx"}, {2, "yy"}, {3, "zz"}}}
+
+	with := New(WithSliceOrdered(true), WithLengthMode(LengthWithElems)).MakePatch(l, r)
+	d, ok := with.Get(".Nums")
+	if !ok || d.Reason != DiffOfSliceLength || d.LeftV.Int() != 3 || d.RightV.Int() != 5 || !with.Has(".Nums[4]") {
+		t.Fatal("should report length with elements", with.Readable())
+	}
+	if d, ok = with.Get(".Labels"); !ok || d.Reason != DiffOfMapLength || !with.Has(".Labels.b") {
+		t.Fatal("should report map length", with.Readable())
+	}
+	target := Clone(nil, l)
+	if err := with.Apply(&target); err != nil || !New(WithSliceOrdered(true)).Compare(target, r, nil) {
+		t.Fatal("length rows should be skipped by apply", err)
+	}
+	if s := with.Summary(); s.Changed() != 4 || s.Resized() != 2 || s.Leaves != 7 || s.String() != "4 changed, 3 added, 2 resized under .Items, .Labels, .Nums" {
+		t.Fatal("length rows should not be counted as changed", s, with.Readable())
+	}
+	lengthOnly := New(WithLengthMode(LengthOnly)).MakePatch(applyDoc{Nums: []int{1}}, applyDoc{Nums: []int{1, 2}})
+	if s := lengthOnly.Summary(); s.MaxDepth != 1 || s.Leaves != 0 {
+		t.Fatal("depth of length rows should be counted", s, lengthOnly.Readable())
+	}
+	data, err := json.Marshal(with)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := UnmarshalPatch(data, applyDoc{})
+	if err != nil || loaded.Readable() != with.Readable() {
+		t.Fatal("bad round trip of length rows", err, loaded.Readable())
+	}
+	if d, _ = loaded.Get(".Nums"); d.LeftV.Kind() != reflect.Int {
+		t.Fatal("length should be int", d.LeftV.Type())
+	}
+	target = Clone(nil, l)
+	if err := with.ApplyStrict(&target); err != nil || !New(WithSliceOrdered(true)).Compare(target, r, nil) {
+		t.Fatal("length rows should pass strict apply", err)
+	}
+	target = Clone(nil, l)
+	target.Nums = append(target.Nums, 9)
+	var conflict *ConflictError
+	if err := with.ApplyStrict(&target); !errors.As(err, &conflict) || conflict.Paths[0] != ".Nums" {
+		t.Fatal("changed length should conflict", err)
+	}
+
+	only := New(WithSliceOrdered(true), WithLengthMode(LengthOnly)).MakePatch(l, r)
+	if only.Has(".Nums[*]") || only.Has(".Labels.a") || only.Has(".Labels.b") || !only.Has(".Nums") || !only.Has(".Items[*].Name") {
+		t.Fatal("should report length only", only.Readable())
+	}
+
+	collapsed := New(WithSliceOrdered(true), WithCollapse(2)).MakePatch(l, r)
+	if d, ok = collapsed.Get(".Items"); !ok || d.Reason != DiffOfValue || d.RightV.Len() != 3 || collapsed.Has(".Items[*].Name") {
+		t.Fatal("items should be collapsed", collapsed.Readable())
+	}
+	if !collapsed.Has(".Labels.a") || !collapsed.Has(".Nums[3]") {
+		t.Fatal("small changes should not be collapsed", collapsed.Readable())
+	}
+	target = Clone(nil, l)
+	if err := collapsed.Apply(&target); err != nil || !New(WithSliceOrdered(true)).Compare(target, r, nil) {
+		t.Fatal("collapsed patch should apply", err)
+	}
+	if New(WithCollapse(2)).Compare(l, r, nil) || !New(WithCollapse(2)).Compare(l, l, nil) {
+		t.Fatal("bad equality with collapse")
+	}
+	// patches without element rows can't be applied
+	lossy := New(WithLengthMode(LengthOnly)).MakePatch(applyDoc{Nums: []int{1}}, applyDoc{Nums: []int{1, 2, 3}})
+	target = applyDoc{Nums: []int{1}}
+	if err := lossy.Apply(&target); err == nil || len(target.Nums) != 1 {
+		t.Fatal("length only patch should fail", target)
+	}
+	if err := lossy.ApplyStrict(&target); err == nil {
+		t.Fatal("length only patch should fail strict apply")
+	}
+
+	// length rows through Compose and Transform
+	lengths := New(WithSliceOrdered(true), WithLengthMode(LengthWithElems))
+	x := applyDoc{Nums: []int{1, 2, 3}}
+	xa, xb := applyDoc{Nums: []int{1, 2, 3, 4}}, applyDoc{Nums: []int{1, 7, 3}}
+	composed, err := Compose(lengths.MakePatch(x, xa), lengths.MakePatch(xa, applyDoc{Nums: []int{1, 3, 4, 5, 6}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d, ok = composed.Get(".Nums"); !ok || d.LeftV.Int() != 3 || d.RightV.Int() != 5 {
+		t.Fatal("length rows should be composed", composed.Readable())
+	}
+	target = Clone(nil, x)
+	if err := composed.ApplyStrict(&target); err != nil || !reflect.DeepEqual(target.Nums, []int{1, 3, 4, 5, 6}) {
+		t.Fatal("bad composed apply", err, target.Nums, composed.Readable())
+	}
+	for _, xb := range []applyDoc{xb, {Nums: []int{1, 2}}} {
+		a, b := lengths.MakePatch(x, xa), lengths.MakePatch(x, xb)
+		a2, b2 := Transform(a, b)
+		ab, ba := Clone(nil, x), Clone(nil, x)
+		for _, step := range []struct {
+			p      Patch
+			target *applyDoc
+		}{{a, &ab}, {b2, &ab}, {b, &ba}, {a2, &ba}} {
+			if err := step.p.ApplyStrict(step.target); err != nil {
+				t.Fatal(err, step.p.Readable())
+			}
+		}
+		if !reflect.DeepEqual(ab.Nums, ba.Nums) || len(ab.Nums) != len(xb.Nums)+1 {
+			t.Fatal("transformed patches should converge", ab.Nums, ba.Nums, a2.Readable(), b2.Readable())
+		}
+	}
+}
+
+func TestExpandSubtrees(t *testing.T) {
+	l := applyDoc{Title: "a"}
+	r := applyDoc{Title: "a", Owner: &applyItem{ID: 1, Name: "bob"}, Attrs: map[string]interface{}{"tags": []interface{}{"x"}}}
+
+	whole := New().MakePatch(l, r)
+	if d, ok := whole.Get(".Owner"); !ok || d.Reason != DiffOfLeftNoValue {
+		t.Fatal("should report owner as a whole", whole.Readable())
+	}
+
+	p := New(WithExpandSubtrees(true)).MakePatch(l, r)
+	if p.Has(".Owner") || p.Has(".Attrs") {
+		t.Fatal("subtrees should be expanded", p.Readable())
+	}
+	d, ok := p.Get(".Owner.Name")
+	if !ok || d.Reason != DiffOfLeftNoValue || d.LeftV.String() != "" || d.RightV.String() != "bob" {
+		t.Fatal("bad leaf row", p.Readable())
+	}
+	if d, ok = p.Get(".Owner.ID"); !ok || d.LeftV.Int() != 0 || d.RightV.Int() != 1 {
+		t.Fatal("bad leaf row", p.Readable())
+	}
+	if !p.Has(".Attrs.tags[0]") {
+		t.Fatal("untyped subtree should be expanded", p.Readable())
+	}
+	target := Clone(nil, l)
+	if err := p.Apply(&target); err != nil || !New().Compare(target, r, nil) {
+		t.Fatal("expanded patch should apply", err)
+	}
+	target = Clone(nil, l)
+	if err := p.ApplyStrict(&target); err != nil || !New().Compare(target, r, nil) {
+		t.Fatal("expanded patch should apply strictly", err)
+	}
+
+	removed := New(WithExpandSubtrees(true)).MakePatch(r, l)
+	if d, ok = removed.Get(".Owner.Name"); !ok || d.Reason != DiffOfRightNoValue || d.LeftV.String() != "bob" || d.RightV.String() != "" {
+		t.Fatal("bad removed leaf row", removed.Readable())
+	}
+	target = Clone(nil, r)
+	// leaf rows clear the leaves, containers of them are kept
+	if err := removed.ApplyStrict(&target); err != nil || target.Owner == nil || *target.Owner != (applyItem{}) {
+		t.Fatal("expanded removal should apply strictly", err, target.Owner)
+	}
+	if New(WithExpandSubtrees(true)).Compare(l, r, nil) {
+		t.Fatal("bad equality with expand")
+	}
+
+	// subtrees without leaves are reported as a whole
+	empty := applyDoc{Owner: &applyItem{}, Labels: map[string]string{}, Attrs: map[string]interface{}{"k": []interface{}{}}}
+	p = New(WithExpandSubtrees(true)).MakePatch(applyDoc{}, empty)
+	if !p.Has(".Labels") || !p.Has(".Attrs") || !p.Has(".Owner.ID") {
+		t.Fatal("empty subtrees should be reported", p.Readable())
+	}
+	type stamped struct {
+		At   time.Time
+		Tags []string
+	}
+	now := time.Now()
+	p = New(WithExpandSubtrees(true)).MakePatch(map[string]*stamped{}, map[string]*stamped{"a": {At: now}})
+	if d, ok = p.Get(".a.At"); !ok || p.Size() != 1 || !d.RightV.Interface().(time.Time).Equal(now) {
+		t.Fatal("struct without exported fields is a leaf", p.Readable())
+	}
+
+	type node struct {
+		V    int
+		Next *node
+	}
+	deep := &node{}
+	for i := 0; i < 50; i++ {
+		deep = &node{V: i, Next: deep}
+	}
+	if _, err := New(WithExpandSubtrees(true), MaxDepth(5)).MakePatchContext(context.Background(), &node{}, &node{Next: deep}); !errors.Is(err, ErrMaxDepth) {
+		t.Fatal("expand should be limited by depth", err)
+	}
+	if _, err := New(WithExpandSubtrees(true), MaxNodes(10)).MakePatchContext(context.Background(), &node{}, &node{Next: deep}); !errors.Is(err, ErrMaxNodes) {
+		t.Fatal("expand should be limited by nodes", err)
+	}
+	cyclic := &node{V: 1}
+	cyclic.Next = cyclic
+	if _, err := New(WithExpandSubtrees(true), MaxNodes(100)).MakePatchContext(context.Background(), &node{}, &node{Next: cyclic}); !errors.Is(err, ErrMaxNodes) {
+		t.Fatal("cyclic subtree should be limited", err)
+	}
+}
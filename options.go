@@ -0,0 +1,89 @@
+package diff
+
+// Option configures a Differ, see New and Differ.With
+type Option func(*config)
+
+// WithOmitPath is the option of Differ.OmitPath
+func WithOmitPath(list ...string) Option {
+	return func(c *config) {
+		c.omitPath(list...)
+	}
+}
+
+// WithCompareFunc is the option of Differ.RegistCompareFunc
+func WithCompareFunc[T any](fn func(l, r T) bool) Option {
+	return func(c *config) {
+		mustRegist(c.registCompareFunc(fn))
+	}
+}
+
+// WithPathCompareFunc is the option of Differ.RegistPathCompareFunc
+func WithPathCompareFunc[T any](path string, fn func(l, r T) bool) Option {
+	return func(c *config) {
+		mustRegist(c.registPathCompareFunc(path, fn))
+	}
+}
+
+// WithCompareKindFunc is the option of Differ.RegistCompareKindFunc, it works for all types of the kind of T
+func WithCompareKindFunc[T any](fn func(l, r T) bool) Option {
+	return func(c *config) {
+		mustRegist(c.registCompareKindFunc(fn))
+	}
+}
+
+// WithIDFunc is the option of Differ.RegistIDFunc
+func WithIDFunc[T any](fn func(T) string) Option {
+	return func(c *config) {
+		mustRegist(c.registIDFunc(fn))
+	}
+}
+
+// WithKindIDFunc is the option of Differ.RegistKindIDFunc, it works for all types of the kind of T
+func WithKindIDFunc[T any](fn func(T) string) Option {
+	return func(c *config) {
+		mustRegist(c.registKindIDFunc(fn))
+	}
+}
+
+// WithPathIDFunc is the option of Differ.RegistPathIDFunc
+func WithPathIDFunc[T any](path string, fn func(T) string) Option {
+	return func(c *config) {
+		mustRegist(c.registPathIDFunc(path, fn))
+	}
+}
+
+// WithSliceOrdered is the option of Differ.SetSliceOrdered
+func WithSliceOrdered(ordered bool) Option {
+	return func(c *config) {
+		c.sliceOrdered = ordered
+	}
+}
+
+// WithStructural is the option of Differ.SetStructural
+func WithStructural(structural bool) Option {
+	return func(c *config) {
+		c.structural = structural
+	}
+}
+
+// WithStructuralTag is the option of Differ.SetStructuralTag
+func WithStructuralTag(tag string) Option {
+	return func(c *config) {
+		c.structuralTag = tag
+	}
+}
+
+// WithAutoDeref is the option of Differ.SetAutoDeref
+func WithAutoDeref(autoDeref bool) Option {
+	return func(c *config) {
+		c.autoDeref = autoDeref
+	}
+}
+
+// WithoutOmitPath clear all omit paths, e.g. base.With(WithoutOmitPath(), WithOmitPath(reloaded...))
+func WithoutOmitPath() Option {
+	return func(c *config) {
+		c.omitPaths = make(map[string]bool)
+		c.omitPrefix = make(map[string]bool)
+	}
+}
@@ -0,0 +1,120 @@
+package diff
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// _PARALLEL_THRESHOLD is the default minimal size of slice/map to be compared in parallel
+const _PARALLEL_THRESHOLD = 1024
+
+// WithParallelism compare elements of large slices and maps by n goroutines, n <= 0 means runtime.NumCPU()
+func WithParallelism(n int) Option {
+	return func(c *config) {
+		if n <= 0 {
+			n = runtime.NumCPU()
+		}
+		c.parallelism = n
+	}
+}
+
+// WithParallelThreshold is the minimal size of slice/map to be compared in parallel
+func WithParallelThreshold(size int) Option {
+	return func(c *config) {
+		c.parallelThreshold = size
+	}
+}
+
+func (df *differ) shouldParallel(size int) bool {
+	if df.nested || df.parallelism <= 1 {
+		return false
+	}
+	threshold := df.parallelThreshold
+	if threshold <= 0 {
+		threshold = _PARALLEL_THRESHOLD
+	}
+	return size >= threshold
+}
+
+// elemResult is the buffered differences of one element
+type elemResult struct {
+	rows []*D
+	diff bool
+	done chan struct{}
+}
+
+// parallelEach compare n elements by workers, the differences are replayed to df in element order,
+// so the result is the same as sequential comparison. Workers stop once df's callback returns false.
+func parallelEach(df *differ, steps []pathStep, n int, cmp func(child *differ, steps []pathStep, i int) bool) bool {
+	results := make([]elemResult, n)
+	for i := range results {
+		results[i].done = make(chan struct{})
+	}
+	var next int64 = -1
+	var stopped int32
+	var wg sync.WaitGroup
+	workers := df.parallelism
+	if workers > n {
+		workers = n
+	}
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				i := int(atomic.AddInt64(&next, 1))
+				if i >= n {
+					return
+				}
+				res := &results[i]
+				if atomic.LoadInt32(&stopped) == 0 {
+					var fn Callback
+					if df.fn != nil {
+						fn = func(d *D) bool {
+							res.rows = append(res.rows, d)
+							return atomic.LoadInt32(&stopped) == 0
+						}
+					}
+					child := acquireChildDiffer(df, fn)
+					cmp(child, append(child.steps, steps...), i)
+					res.diff = child.differenceExist
+					releaseDiffer(child)
+				}
+				close(res.done)
+			}
+		}()
+	}
+	defer func() {
+		atomic.StoreInt32(&stopped, 1)
+		wg.Wait()
+	}()
+	for i := range results {
+		<-results[i].done
+		if !df.replay(results[i].rows, results[i].diff) {
+			return false
+		}
+	}
+	return true
+}
+
+// replay buffered differences of a child differ
+func (df *differ) replay(rows []*D, diff bool) bool {
+	if df.fn == nil {
+		if diff {
+			df.differenceExist = true
+			return false
+		}
+		return df.stopErr() == nil
+	}
+	for _, d := range rows {
+		if !df.nested && !df.addDiff() {
+			return false
+		}
+		df.differenceExist = true
+		if !df.fn(d) {
+			return false
+		}
+	}
+	return df.stopErr() == nil
+}
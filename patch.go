@@ -13,6 +13,8 @@ type D struct {
 	Reason Reason
 	LeftV  reflect.Value
 	RightV reflect.Value
+	// seq is the order in patch
+	seq int
 }
 
 // Indirect of D
@@ -22,12 +24,17 @@ func (d D) Indirect() *D {
 		Reason: d.Reason,
 		LeftV:  reflect.Indirect(d.LeftV),
 		RightV: reflect.Indirect(d.RightV),
+		seq:    d.seq,
 	}
 }
 
 // Patch is result of diff
 type Patch struct {
 	List []*D
+	// differ made the patch, its rules are used by ApplyStrict
+	differ *Differ
+	// rootType is the type of left value, fields of it are named by json tags when applied to untyped documents
+	rootType reflect.Type
 }
 
 // DInterface is interface of D
@@ -53,6 +60,7 @@ func (p *Patch) IsEmpty() bool {
 }
 
 func (p *Patch) add(d *D) *Patch {
+	d.seq = len(p.List)
 	p.List = append(p.List, d)
 	return p
 }
@@ -0,0 +1,122 @@
+package diff
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// jsonD is the json form of D, absent value means no value
+type jsonD struct {
+	Path   string          `json:"path"`
+	Reason Reason          `json:"reason"`
+	Left   json.RawMessage `json:"left,omitempty"`
+	Right  json.RawMessage `json:"right,omitempty"`
+}
+
+// MarshalJSON encode patch as a list of path, reason and values
+func (p Patch) MarshalJSON() ([]byte, error) {
+	list := make([]jsonD, 0, len(p.List))
+	for _, d := range p.List {
+		jd := jsonD{Path: d.Path, Reason: d.Reason}
+		var err error
+		if jd.Left, err = marshalValue(d.Path, d.LeftV); err != nil {
+			return nil, err
+		}
+		if jd.Right, err = marshalValue(d.Path, d.RightV); err != nil {
+			return nil, err
+		}
+		list = append(list, jd)
+	}
+	return json.Marshal(list)
+}
+
+// marshalValue encode v of the row at path, invalid value is absent
+func marshalValue(path string, v reflect.Value) (json.RawMessage, error) {
+	if !v.IsValid() {
+		return nil, nil
+	}
+	if !v.CanInterface() {
+		return nil, fmt.Errorf("diff: can't marshal %s: value of unexported field", path)
+	}
+	return json.Marshal(v.Interface())
+}
+
+// UnmarshalPatch decode patch made by Patch.MarshalJSON, values are typed by the paths of sample which has the type of compared objects.
+// Values under interface or unknown paths are decoded as untyped json.
+func UnmarshalPatch(data []byte, sample interface{}) (Patch, error) {
+	var list []jsonD
+	if err := json.Unmarshal(data, &list); err != nil {
+		return Patch{}, err
+	}
+	root := reflect.TypeOf(sample)
+	patch := Patch{rootType: root}
+	for _, jd := range list {
+		var t reflect.Type
+		switch jd.Reason {
+		case DiffOfType:
+		case DiffOfSliceLength, DiffOfMapLength:
+			t = reflect.TypeOf(0)
+		default:
+			t = typeOfPath(root, jd.Path)
+		}
+		d := &D{Path: jd.Path, Reason: jd.Reason}
+		var err error
+		if d.LeftV, err = unmarshalValue(jd.Left, t); err != nil {
+			return Patch{}, err
+		}
+		if d.RightV, err = unmarshalValue(jd.Right, t); err != nil {
+			return Patch{}, err
+		}
+		patch.add(d)
+	}
+	return patch, nil
+}
+
+func unmarshalValue(data json.RawMessage, t reflect.Type) (reflect.Value, error) {
+	if len(data) == 0 {
+		return reflect.Value{}, nil
+	}
+	if t == nil {
+		t = reflect.TypeOf((*interface{})(nil)).Elem()
+	}
+	v := reflect.New(t)
+	if err := json.Unmarshal(data, v.Interface()); err != nil {
+		return reflect.Value{}, err
+	}
+	return v.Elem(), nil
+}
+
+// typeOfPath is the declared type of path in t, nil if the path can't be resolved
+func typeOfPath(t reflect.Type, path string) reflect.Type {
+	if t == nil || path == "" {
+		return nil
+	}
+	if path == _ROOT {
+		return t
+	}
+	declared := t
+	for path != "" {
+		var token string
+		token, path = nextPathToken(path)
+		t = indirectType(declared)
+		switch {
+		case token == _SPLITTOR:
+			continue
+		case isIndexToken(token) && isListKind(t.Kind()):
+			declared = t.Elem()
+		case strings.HasPrefix(token, _SPLITTOR) && t.Kind() == reflect.Map:
+			declared = t.Elem()
+		case strings.HasPrefix(token, _SPLITTOR) && t.Kind() == reflect.Struct:
+			f, ok := t.FieldByName(token[1:])
+			if !ok {
+				return nil
+			}
+			declared = f.Type
+		default:
+			return nil
+		}
+	}
+	return declared
+}
@@ -0,0 +1,101 @@
+package diff
+
+import (
+	"strings"
+)
+
+// MatchPath whether path matches pattern, the row of path is skipped by OmitPath(pattern) exactly when it matches:
+// absolute path .A.B.C, last path step C, slice fuzzy path .A[*].C or prefix .A.* which matches .A and paths with prefix .A
+func MatchPath(pattern, path string) bool {
+	return pathMatcher(pattern)(path)
+}
+
+// pathMatcher match paths by the rules of OmitPath
+func pathMatcher(patterns ...string) func(string) bool {
+	c := &config{omitPaths: make(map[string]bool), omitPrefix: make(map[string]bool)}
+	c.omitPath(patterns...)
+	return c.isOmit
+}
+
+// Filter rows by fn
+func (p *Patch) Filter(fn func(*D) bool) Patch {
+	res := Patch{differ: p.differ, rootType: p.rootType}
+	for _, d := range p.List {
+		if fn(d) {
+			res.List = append(res.List, d)
+		}
+	}
+	return res
+}
+
+// Select rows whose path matches pattern, see MatchPath
+func (p *Patch) Select(pattern string) Patch {
+	match := pathMatcher(pattern)
+	return p.Filter(func(d *D) bool { return match(d.Path) })
+}
+
+// Exclude rows whose path matches pattern, see MatchPath
+func (p *Patch) Exclude(pattern string) Patch {
+	match := pathMatcher(pattern)
+	return p.Filter(func(d *D) bool { return !match(d.Path) })
+}
+
+// Get row of path
+func (p *Patch) Get(path string) (*D, bool) {
+	for _, d := range p.List {
+		if d.Path == path {
+			return d, true
+		}
+	}
+	return nil, false
+}
+
+// Has any row whose path matches pattern, see MatchPath
+func (p *Patch) Has(pattern string) bool {
+	match := pathMatcher(pattern)
+	for _, d := range p.List {
+		if match(d.Path) {
+			return true
+		}
+	}
+	return false
+}
+
+// GroupByPrefix group rows by the first depth steps of path, e.g. .Items for .Items[1].Name when depth is 1
+func (p *Patch) GroupByPrefix(depth int) map[string]Patch {
+	groups := make(map[string]Patch)
+	for _, d := range p.List {
+		prefix := pathPrefix(d.Path, depth)
+		g := groups[prefix]
+		g.differ, g.rootType = p.differ, p.rootType
+		g.List = append(g.List, d)
+		groups[prefix] = g
+	}
+	return groups
+}
+
+// ByReason group rows by reason
+func (p *Patch) ByReason() map[Reason]Patch {
+	groups := make(map[Reason]Patch)
+	for _, d := range p.List {
+		g := groups[d.Reason]
+		g.differ, g.rootType = p.differ, p.rootType
+		g.List = append(g.List, d)
+		groups[d.Reason] = g
+	}
+	return groups
+}
+
+// pathPrefix is the first depth steps of path
+func pathPrefix(path string, depth int) string {
+	var b strings.Builder
+	for rest := path; rest != "" && depth > 0; {
+		var token string
+		token, rest = nextPathToken(rest)
+		b.WriteString(token)
+		if token != _SPLITTOR {
+			depth--
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,106 @@
+package diff
+
+import (
+	"reflect"
+	"strconv"
+	"sync"
+)
+
+// planCache keeps compiled plans per type, it belongs to a frozen config
+type planCache struct {
+	structs sync.Map
+	idFns   sync.Map
+}
+
+func newPlanCache() *planCache {
+	return &planCache{}
+}
+
+type fieldPlan struct {
+	index int
+	name  string
+	t     reflect.Type
+	// cmpFn is the compare func of field type, invalid if none
+	cmpFn reflect.Value
+	// pathCmp means the compare func depends on path
+	pathCmp bool
+}
+
+type structPlan struct {
+	fields []fieldPlan
+}
+
+// structPlan compile exported fields of struct type
+func (c *config) structPlan(t reflect.Type) *structPlan {
+	if p, ok := c.plans.structs.Load(t); ok {
+		return p.(*structPlan)
+	}
+	p := &structPlan{}
+	for i := 0; i < t.NumField(); i++ {
+		ft := t.Field(i)
+		if !isExported(ft.Name) {
+			continue
+		}
+		fp := fieldPlan{index: i, name: ft.Name, t: ft.Type, pathCmp: c.pathCmpTypes[ft.Type]}
+		if fn, ok := c.cmpFuncs[ft.Type]; ok {
+			fp.cmpFn = fn
+		}
+		p.fields = append(p.fields, fp)
+	}
+	c.plans.structs.Store(t, p)
+	return p
+}
+
+// equalByKind is the same as default compare kind funcs without reflect call
+func equalByKind(kind reflect.Kind, lv, rv reflect.Value) bool {
+	switch kind {
+	case reflect.Bool:
+		return lv.Bool() == rv.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return lv.Int() == rv.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return lv.Uint() == rv.Uint()
+	case reflect.Float32:
+		return float32(floatOf(lv)) == float32(floatOf(rv))
+	case reflect.Float64:
+		return floatOf(lv) == floatOf(rv)
+	case reflect.String:
+		return lv.String() == rv.String()
+	case reflect.UnsafePointer:
+		return lv.Pointer() == rv.Pointer()
+	}
+	return false
+}
+
+func floatOf(v reflect.Value) float64 {
+	switch {
+	case isSignedKind(v.Kind()):
+		return float64(v.Int())
+	case isUnsignedKind(v.Kind()):
+		return float64(v.Uint())
+	}
+	return v.Float()
+}
+
+// directIDFn is the same as default kind id funcs without reflect call
+func directIDFn(isPtr bool) getIDFunc {
+	return func(_v reflect.Value) string {
+		if isPtr && _v.IsValid() {
+			_v = _v.Elem()
+		}
+		if !_v.IsValid() {
+			return _ZERO
+		}
+		switch _v.Kind() {
+		case reflect.Bool:
+			return IDOfBool(_v.Bool())
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return strconv.FormatInt(_v.Int(), 10)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			return strconv.FormatUint(_v.Uint(), 10)
+		case reflect.Float32, reflect.Float64:
+			return strconv.FormatFloat(_v.Float(), 'f', 6, 64)
+		}
+		return _v.String()
+	}
+}
@@ -0,0 +1,6 @@
+//go:build race
+
+package diff
+
+// sync.Pool drops items randomly with race detector
+const raceEnabled = true
@@ -0,0 +1,177 @@
+package diff
+
+import (
+	"reflect"
+	"time"
+)
+
+// Resolver resolve a merge conflict to a value, false means it can't be resolved.
+// It's invoked when both sides changed the path to different values, before children of the path are merged.
+type Resolver func(c *Conflict) (v reflect.Value, ok bool)
+
+// RegistPathResolver resolve conflicts of path, the path can be absolute path .A.B.C or last path step C or slice fuzzy path .A[*].C
+func (df *Differ) RegistPathResolver(path string, r Resolver) {
+	df.update(func(c *config) error {
+		c.pathResolvers[path] = r
+		return nil
+	})
+}
+
+// WithPathResolver is the option of Differ.RegistPathResolver
+func WithPathResolver(path string, r Resolver) Option {
+	return func(c *config) {
+		c.pathResolvers[path] = r
+	}
+}
+
+// WithResolver resolve conflicts of values of type T
+func WithResolver[T any](r Resolver) Option {
+	return func(c *config) {
+		c.typeResolvers[reflect.TypeOf((*T)(nil)).Elem()] = r
+	}
+}
+
+// RegisterResolver resolve conflicts of values of type T
+func RegisterResolver[T any](df *Differ, r Resolver) {
+	df.update(func(c *config) error {
+		c.typeResolvers[reflect.TypeOf((*T)(nil)).Elem()] = r
+		return nil
+	})
+}
+
+func (c *config) resolverOf(steps []pathStep, t reflect.Type) Resolver {
+	if len(c.pathResolvers) > 0 && len(steps) > 0 {
+		p := buildPath(steps)
+		if r, ok := c.pathResolvers[p]; ok {
+			return r
+		}
+		if r, ok := c.pathResolvers[replaceSliceIndexToStar(p)]; ok {
+			return r
+		}
+		if r, ok := c.pathResolvers[LastNodeOfPath(p)]; ok {
+			return r
+		}
+	}
+	return c.typeResolvers[t]
+}
+
+// PreferOurs take ours for conflicts
+func PreferOurs(c *Conflict) (reflect.Value, bool) {
+	return c.Ours, true
+}
+
+// PreferTheirs take theirs for conflicts
+func PreferTheirs(c *Conflict) (reflect.Value, bool) {
+	return c.Theirs, true
+}
+
+// PreferNewest take the side whose timestamp at tsPath of the merged object is newer, the timestamp is time.Time or unix integer
+func PreferNewest(tsPath string) Resolver {
+	return func(c *Conflict) (reflect.Value, bool) {
+		ours, ok1 := timestampOf(c.m.ours, tsPath)
+		theirs, ok2 := timestampOf(c.m.theirs, tsPath)
+		switch {
+		case !ok1 || !ok2 || ours.Equal(theirs):
+			return reflect.Value{}, false
+		case ours.After(theirs):
+			return c.Ours, true
+		}
+		return c.Theirs, true
+	}
+}
+
+func timestampOf(root reflect.Value, path string) (time.Time, bool) {
+	v, ok := valueOfPath(root, path)
+	if v = indirectValue(v); !ok || !v.IsValid() || !v.CanInterface() {
+		return time.Time{}, false
+	}
+	switch {
+	case isSignedKind(v.Kind()):
+		return time.Unix(v.Int(), 0), true
+	case isUnsignedKind(v.Kind()):
+		return time.Unix(int64(v.Uint()), 0), true
+	}
+	ts, ok := v.Interface().(time.Time)
+	return ts, ok
+}
+
+// Sum add changes of both sides to base, it works for numbers
+func Sum(c *Conflict) (reflect.Value, bool) {
+	if !c.Ours.IsValid() || !c.Theirs.IsValid() {
+		return reflect.Value{}, false
+	}
+	t := c.Ours.Type()
+	base := c.Base
+	if !base.IsValid() {
+		base = reflect.Zero(t)
+	}
+	v := reflect.New(t).Elem()
+	switch {
+	case isSignedKind(t.Kind()):
+		v.SetInt(c.Ours.Int() + c.Theirs.Int() - base.Int())
+	case isUnsignedKind(t.Kind()):
+		v.SetUint(c.Ours.Uint() + c.Theirs.Uint() - base.Uint())
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		v.SetFloat(c.Ours.Float() + c.Theirs.Float() - base.Float())
+	default:
+		return reflect.Value{}, false
+	}
+	return v, true
+}
+
+// SetUnion keep elements of both sides for slices, elements are identified like MakePatch, e.g. by RegistIDFunc.
+// Elements of base deleted by either side are dropped, elements only in theirs are placed after the element before them in theirs.
+func SetUnion(c *Conflict) (reflect.Value, bool) {
+	if !c.Ours.IsValid() || !c.Theirs.IsValid() || c.Ours.Kind() != reflect.Slice {
+		return reflect.Value{}, false
+	}
+	t := c.Ours.Type()
+	getIDFn := getIDFn(c.m.df, c.steps, t.Elem())
+	idsOf := func(v reflect.Value) (ids []string, set map[string]bool) {
+		set = make(map[string]bool)
+		if !v.IsValid() || v.Kind() != reflect.Slice {
+			return
+		}
+		for i := 0; i < v.Len(); i++ {
+			id := getIDFn(v.Index(i))
+			ids, set[id] = append(ids, id), true
+		}
+		return
+	}
+	_, base := idsOf(c.Base)
+	oursIDs, ours := idsOf(c.Ours)
+	theirsIDs, theirs := idsOf(c.Theirs)
+	deleted := func(id string) bool { return base[id] && (!ours[id] || !theirs[id]) }
+
+	var ids []string
+	var elems []reflect.Value
+	pos := make(map[string]int)
+	for i, id := range oursIDs {
+		if _, ok := pos[id]; !ok && !deleted(id) {
+			pos[id] = len(ids)
+			ids, elems = append(ids, id), append(elems, c.Ours.Index(i))
+		}
+	}
+	// anchor is the position of the last element of theirs in the result
+	anchor := -1
+	for i, id := range theirsIDs {
+		if p, ok := pos[id]; ok {
+			anchor = p
+			continue
+		}
+		if deleted(id) {
+			continue
+		}
+		anchor++
+		ids = append(ids[:anchor], append([]string{id}, ids[anchor:]...)...)
+		elems = append(elems[:anchor], append([]reflect.Value{c.Theirs.Index(i)}, elems[anchor:]...)...)
+		for j := anchor; j < len(ids); j++ {
+			pos[ids[j]] = j
+		}
+	}
+	nv := reflect.MakeSlice(t, 0, len(elems))
+	for _, elem := range elems {
+		nv = reflect.Append(nv, elem)
+	}
+	return nv, true
+}
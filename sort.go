@@ -0,0 +1,181 @@
+package diff
+
+import (
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SortBy is the order of Patch.List
+type SortBy int
+
+const (
+	// SortBySource the order differences are found, it's the default order of MakePatch
+	SortBySource SortBy = iota
+	// SortByPath path order, indexes are compared as numbers
+	SortByPath
+	// SortByReason reason order, then path order
+	SortByReason
+)
+
+// Sort list of patch stably
+func (p *Patch) Sort(by SortBy) *Patch {
+	switch by {
+	case SortByPath:
+		sort.SliceStable(p.List, func(i, j int) bool {
+			return comparePath(p.List[i].Path, p.List[j].Path) < 0
+		})
+	case SortByReason:
+		sort.SliceStable(p.List, func(i, j int) bool {
+			if p.List[i].Reason != p.List[j].Reason {
+				return p.List[i].Reason < p.List[j].Reason
+			}
+			return comparePath(p.List[i].Path, p.List[j].Path) < 0
+		})
+	default:
+		sort.SliceStable(p.List, func(i, j int) bool {
+			return p.List[i].seq < p.List[j].seq
+		})
+	}
+	return p
+}
+
+// comparePath compare paths token by token, index tokens like [10] are compared as numbers
+func comparePath(a, b string) int {
+	for a != "" && b != "" {
+		var ta, tb string
+		ta, a = nextPathToken(a)
+		tb, b = nextPathToken(b)
+		if c := comparePathToken(ta, tb); c != 0 {
+			return c
+		}
+	}
+	return len(a) - len(b)
+}
+
+func nextPathToken(p string) (token, rest string) {
+	end := strings.IndexAny(p[1:], _SPLITTOR+"[")
+	if end < 0 {
+		return p, ""
+	}
+	return p[:end+1], p[end+1:]
+}
+
+func comparePathToken(a, b string) int {
+	if isIndexToken(a) && isIndexToken(b) {
+		ia, _ := strconv.Atoi(a[1 : len(a)-1])
+		ib, _ := strconv.Atoi(b[1 : len(b)-1])
+		return ia - ib
+	}
+	return strings.Compare(a, b)
+}
+
+// sortMapKeys sort keys of the same type, so maps are traversed in deterministic order
+func sortMapKeys(keys []reflect.Value) []reflect.Value {
+	sort.Slice(keys, func(i, j int) bool { return compareValue(keys[i], keys[j]) < 0 })
+	return keys
+}
+
+// _MAX_KEY_DEREF is the number of pointers dereferenced when keys are compared, cyclic keys are ordered by address
+const _MAX_KEY_DEREF = 8
+
+// compareValue is a total order of comparable values like fmt sorts map keys,
+// pointers are ordered by pointed-to values and their addresses are the last tiebreak
+func compareValue(a, b reflect.Value) int {
+	return compareValueDeref(a, b, 0)
+}
+
+func compareValueDeref(a, b reflect.Value, deref int) int {
+	if a.Type() != b.Type() {
+		return strings.Compare(a.Type().String(), b.Type().String())
+	}
+	switch a.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return compareOrdered(a.Int(), b.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return compareOrdered(a.Uint(), b.Uint())
+	case reflect.String:
+		return strings.Compare(a.String(), b.String())
+	case reflect.Float32, reflect.Float64:
+		return compareFloat(a.Float(), b.Float())
+	case reflect.Complex64, reflect.Complex128:
+		if c := compareFloat(real(a.Complex()), real(b.Complex())); c != 0 {
+			return c
+		}
+		return compareFloat(imag(a.Complex()), imag(b.Complex()))
+	case reflect.Bool:
+		if a.Bool() == b.Bool() {
+			return 0
+		} else if a.Bool() {
+			return 1
+		}
+		return -1
+	case reflect.Ptr:
+		if a.IsNil() || b.IsNil() || deref >= _MAX_KEY_DEREF {
+			return compareOrdered(a.Pointer(), b.Pointer())
+		}
+		if c := compareValueDeref(a.Elem(), b.Elem(), deref+1); c != 0 {
+			return c
+		}
+		return compareOrdered(a.Pointer(), b.Pointer())
+	case reflect.UnsafePointer, reflect.Chan:
+		// nothing but the address to compare
+		return compareOrdered(a.Pointer(), b.Pointer())
+	case reflect.Struct:
+		for i := 0; i < a.NumField(); i++ {
+			if c := compareValueDeref(a.Field(i), b.Field(i), deref); c != 0 {
+				return c
+			}
+		}
+		return 0
+	case reflect.Array:
+		for i := 0; i < a.Len(); i++ {
+			if c := compareValueDeref(a.Index(i), b.Index(i), deref); c != 0 {
+				return c
+			}
+		}
+		return 0
+	case reflect.Interface:
+		if a.IsNil() || b.IsNil() {
+			return compareOrdered(boolInt(!a.IsNil()), boolInt(!b.IsNil()))
+		}
+		return compareValueDeref(a.Elem(), b.Elem(), deref)
+	}
+	return 0
+}
+
+func compareOrdered[T int64 | uint64 | uintptr](a, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// compareFloat NaN is less than other numbers
+func compareFloat(a, b float64) int {
+	switch {
+	case math.IsNaN(a) && math.IsNaN(b):
+		return 0
+	case math.IsNaN(a):
+		return -1
+	case math.IsNaN(b):
+		return 1
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func boolInt(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
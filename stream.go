@@ -0,0 +1,32 @@
+package diff
+
+import (
+	"context"
+)
+
+// Stream differences of l and r through a channel, the comparison runs in another goroutine and waits for the consumer.
+// The channel is closed when the comparison finishes or ctx is done, cancel ctx to stop consuming early.
+// The error channel receives the error of the comparison after the channel of differences is closed,
+// nil means all differences are sent, otherwise the differences are truncated.
+func (df *Differ) Stream(ctx context.Context, l interface{}, r interface{}) (<-chan *D, <-chan error) {
+	ch, errc := make(chan *D), make(chan error, 1)
+	go func() {
+		defer close(errc)
+		var cancelled bool
+		_, err := df.compare(ctx, l, r, func(d *D) bool {
+			select {
+			case ch <- d:
+				return true
+			case <-ctx.Done():
+				cancelled = true
+				return false
+			}
+		})
+		if err == nil && cancelled {
+			err = ctx.Err()
+		}
+		close(ch)
+		errc <- err
+	}()
+	return ch, errc
+}
@@ -0,0 +1,91 @@
+package diff
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// ConflictError paths whose current values are not the left values of patch
+type ConflictError struct {
+	Paths []string
+}
+
+func (e *ConflictError) Error() string {
+	return "diff: current values are changed at " + strings.Join(e.Paths, ", ")
+}
+
+// ApplyStrict is Apply which verifies the current value of every row equals its left value first,
+// by the rules of the differ made the patch. A *ConflictError is returned and target is not changed if any row mismatches.
+func (p *Patch) ApplyStrict(target interface{}) error {
+	df := p.differ
+	if df == nil {
+		df = defaultDiffer
+	}
+	tv := reflect.ValueOf(target)
+	var paths []string
+	for _, d := range p.List {
+		if !df.testRow(tv, d) {
+			paths = append(paths, d.Path)
+		}
+	}
+	if len(paths) > 0 {
+		return &ConflictError{Paths: paths}
+	}
+	return p.Apply(target)
+}
+
+// testRow whether the current value at path of row is the left value
+func (df *Differ) testRow(target reflect.Value, d *D) bool {
+	if d.Reason == DiffOfRightElemAdded {
+		return true
+	}
+	cur, ok := valueOfPath(target, d.Path)
+	if ok && isLengthRow(d) {
+		// length rows carry the lengths of the container
+		cv := indirectValue(cur)
+		return cv.IsValid() && (isListKind(cv.Kind()) || cv.Kind() == reflect.Map) && d.LeftV.IsValid() && cv.Len() == int(d.LeftV.Int())
+	}
+	if !ok {
+		switch d.Reason {
+		case DiffOfLeftNoValue:
+			// leaf rows of expanded subtrees carry zero left values
+			return true
+		case DiffOfRightNoValue:
+			return !d.LeftV.IsValid() || d.LeftV.IsZero()
+		}
+		return !d.LeftV.IsValid()
+	}
+	if d.Reason == DiffOfLeftNoValue && !d.LeftV.IsValid() {
+		return false
+	}
+	lv, rv := indirectValue(cur), indirectValue(d.LeftV)
+	if !lv.IsValid() || !rv.IsValid() {
+		return lv.IsValid() == rv.IsValid()
+	}
+	if lv.Type() != rv.Type() {
+		return false
+	}
+	_differ := acquireDiffer(df, nil)
+	defer releaseDiffer(_differ)
+	steps := stepsOfPath(_differ.steps, d.Path)
+	cmpVal(_differ, steps, lv.Type(), lv, rv)
+	return !_differ.differenceExist
+}
+
+// stepsOfPath parse path to steps, so rules of path are applied
+func stepsOfPath(steps []pathStep, path string) []pathStep {
+	for path != "" {
+		var token string
+		token, path = nextPathToken(path)
+		switch {
+		case token == _SPLITTOR:
+		case isIndexToken(token):
+			i, _ := strconv.Atoi(token[1 : len(token)-1])
+			steps = append(steps, indexStep(i, nil))
+		default:
+			steps = append(steps, fieldStep(strings.TrimPrefix(token, _SPLITTOR), nil))
+		}
+	}
+	return steps
+}
@@ -0,0 +1,128 @@
+package diff
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Summary is the statistics of patch
+type Summary struct {
+	// Reasons count of rows per reason
+	Reasons map[Reason]int
+	// Fields count of rows per top level field like .Items
+	Fields map[string]int
+	// Leaves count of rows of primitive values
+	Leaves int
+	// Containers count of rows of struct, map, slice and array values
+	Containers int
+	// MaxDepth the maximum steps of path
+	MaxDepth int
+}
+
+// Summary statistics of patch
+func (p *Patch) Summary() Summary {
+	s := Summary{Reasons: make(map[Reason]int), Fields: make(map[string]int)}
+	for _, d := range p.List {
+		s.Reasons[d.Reason]++
+		s.Fields[pathPrefix(d.Path, 1)]++
+		if depth := pathDepth(d.Path); depth > s.MaxDepth {
+			s.MaxDepth = depth
+		}
+		if isLengthRow(d) {
+			continue
+		}
+		if isContainer(d.LeftV) || isContainer(d.RightV) {
+			s.Containers++
+		} else {
+			s.Leaves++
+		}
+	}
+	return s
+}
+
+// Changed count of rows which change values, length rows only describe the change and are not counted
+func (s Summary) Changed() int {
+	return s.total() - s.Added() - s.Removed() - s.Resized()
+}
+
+// Resized count of length rows of slices and maps
+func (s Summary) Resized() int {
+	return s.Reasons[DiffOfSliceLength] + s.Reasons[DiffOfMapLength]
+}
+
+// Added count of rows which add values
+func (s Summary) Added() int {
+	return s.Reasons[DiffOfRightElemAdded] + s.Reasons[DiffOfLeftNoValue]
+}
+
+// Removed count of rows which remove values
+func (s Summary) Removed() int {
+	return s.Reasons[DiffOfLeftElemRemoved] + s.Reasons[DiffOfRightNoValue]
+}
+
+func (s Summary) total() int {
+	var n int
+	for _, c := range s.Reasons {
+		n += c
+	}
+	return n
+}
+
+// _SUMMARY_FIELDS is the number of fields listed by Summary.String
+const _SUMMARY_FIELDS = 3
+
+// String is one line like "3 changed, 1 added, 2 removed, 1 resized under .Items, .Addr, .Tags +2 more",
+// fields of most rows are listed
+func (s Summary) String() string {
+	if s.total() == 0 {
+		return "no changes"
+	}
+	var parts []string
+	for _, c := range []struct {
+		n    int
+		verb string
+	}{{s.Changed(), "changed"}, {s.Added(), "added"}, {s.Removed(), "removed"}, {s.Resized(), "resized"}} {
+		if c.n > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", c.n, c.verb))
+		}
+	}
+	fields := make([]string, 0, len(s.Fields))
+	for f := range s.Fields {
+		fields = append(fields, f)
+	}
+	sort.Slice(fields, func(i, j int) bool {
+		if ci, cj := s.Fields[fields[i]], s.Fields[fields[j]]; ci != cj {
+			return ci > cj
+		}
+		return comparePath(fields[i], fields[j]) < 0
+	})
+	var more string
+	if len(fields) > _SUMMARY_FIELDS {
+		more = fmt.Sprintf(" +%d more", len(fields)-_SUMMARY_FIELDS)
+		fields = fields[:_SUMMARY_FIELDS]
+	}
+	return strings.Join(parts, ", ") + " under " + strings.Join(fields, ", ") + more
+}
+
+func isContainer(v reflect.Value) bool {
+	switch indirectValue(v).Kind() {
+	case reflect.Struct, reflect.Map, reflect.Slice, reflect.Array:
+		return true
+	}
+	return false
+}
+
+// pathDepth is the number of steps of path, the root is 0
+func pathDepth(path string) int {
+	var depth int
+	for rest := path; rest != ""; {
+		var token string
+		token, rest = nextPathToken(rest)
+		if token != _SPLITTOR {
+			depth++
+		}
+	}
+	return depth
+}
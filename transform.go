@@ -0,0 +1,292 @@
+package diff
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Transform concurrent patches a and b of the same value x, so that applying b2 after a equals applying a2 after b.
+// Slice indexes are shifted by elements added and removed by the other patch, elements are positioned after
+// the nearest element of x before them, and elements of a go first at the same position.
+// Conflicts are reconciled as follows: removal of a slice element wins, a wins for the same path,
+// and a change under the path changed by the other patch is merged into the value of that path if possible.
+func Transform(a, b Patch) (a2, b2 Patch) {
+	t := transformer{sides: [2]*Patch{&a, &b}, models: make(map[string]*sliceModel)}
+	t.buildModels()
+	return t.transform(0), t.transform(1)
+}
+
+// sliceAdd is an element added at right index idx, it's after element anchor of x
+type sliceAdd struct {
+	idx    int
+	anchor int
+	rank   int
+}
+
+// sliceModel is the changes of a slice by both patches in the indexes of x
+type sliceModel struct {
+	removed [2]map[int]bool
+	adds    [2][]sliceAdd
+}
+
+type transformer struct {
+	sides  [2]*Patch
+	models map[string]*sliceModel
+}
+
+func lastIndexToken(path string) (prefix string, idx int, ok bool) {
+	i := strings.LastIndexByte(path, '[')
+	if i < 0 || !isIndexToken(path[i:]) {
+		return "", 0, false
+	}
+	idx, _ = strconv.Atoi(path[i+1 : len(path)-1])
+	return path[:i], idx, true
+}
+
+func (t *transformer) model(prefix string) *sliceModel {
+	m, ok := t.models[prefix]
+	if !ok {
+		m = &sliceModel{removed: [2]map[int]bool{{}, {}}}
+		t.models[prefix] = m
+	}
+	return m
+}
+
+func (t *transformer) buildModels() {
+	for side, p := range t.sides {
+		for _, d := range p.List {
+			prefix, idx, ok := lastIndexToken(d.Path)
+			if !ok {
+				continue
+			}
+			switch d.Reason {
+			case DiffOfLeftElemRemoved:
+				t.model(prefix).removed[side][idx] = true
+			case DiffOfRightElemAdded:
+				m := t.model(prefix)
+				m.adds[side] = append(m.adds[side], sliceAdd{idx: idx})
+			}
+		}
+	}
+	for _, m := range t.models {
+		for side := range m.adds {
+			adds := m.adds[side]
+			sort.Slice(adds, func(i, j int) bool { return adds[i].idx < adds[j].idx })
+			for i := range adds {
+				// elements of x survived before the added one
+				adds[i].anchor = m.survivor(side, adds[i].idx-i-1)
+				if i > 0 && adds[i-1].anchor == adds[i].anchor {
+					adds[i].rank = adds[i-1].rank + 1
+				}
+			}
+		}
+	}
+}
+
+// survivor is the index in x of the n-th element not removed by side, -1 if n < 0
+func (m *sliceModel) survivor(side int, n int) int {
+	if n < 0 {
+		return -1
+	}
+	for i, count := 0, 0; ; i++ {
+		if m.removed[side][i] {
+			continue
+		}
+		if count == n {
+			return i
+		}
+		count++
+	}
+}
+
+// pos is the index of element i of x in the result of side
+func (m *sliceModel) pos(side int, i int) int {
+	p := i
+	for j := range m.removed[side] {
+		if j < i {
+			p--
+		}
+	}
+	for _, add := range m.adds[side] {
+		if add.anchor < i {
+			p++
+		}
+	}
+	return p
+}
+
+// finalPos is the index of the element added at idx by side in the result of both patches
+func (m *sliceModel) finalPos(side int, idx int) int {
+	var add sliceAdd
+	for _, a := range m.adds[side] {
+		if a.idx == idx {
+			add = a
+		}
+	}
+	p := add.anchor + 1
+	for j := 0; j <= add.anchor; j++ {
+		if m.removed[0][j] || m.removed[1][j] {
+			p--
+		}
+	}
+	for s := range m.adds {
+		for _, a := range m.adds[s] {
+			if a.anchor < add.anchor || (a.anchor == add.anchor && s < side) {
+				p++
+			}
+		}
+	}
+	return p + add.rank
+}
+
+// rewritePath shift indexes of the row of side to the result of the other side, false if the element is removed by the other side
+func (t *transformer) rewritePath(path string, side int, d *D) (string, bool) {
+	other := 1 - side
+	var prefix, out strings.Builder
+	for rest := path; rest != ""; {
+		var token string
+		token, rest = nextPathToken(rest)
+		m, ok := t.models[prefix.String()]
+		prefix.WriteString(token)
+		if !isIndexToken(token) || !ok {
+			out.WriteString(token)
+			continue
+		}
+		i, _ := strconv.Atoi(token[1 : len(token)-1])
+		if rest == "" && d != nil && d.Reason == DiffOfRightElemAdded {
+			i = m.finalPos(side, i)
+		} else if m.removed[other][i] {
+			return "", false
+		} else {
+			i = m.pos(other, i)
+		}
+		out.WriteString(buildIndexStep(i))
+	}
+	return out.String(), true
+}
+
+// absorb apply rows of the other side under the path of d to the right value of d
+func (t *transformer) absorb(d *D, side int) (*D, bool) {
+	var children []*D
+	for _, c := range t.sides[1-side].List {
+		if !isLengthRow(c) && isSubPath(d.Path, c.Path) {
+			children = append(children, relativeD(c, d.Path))
+		}
+	}
+	if len(children) == 0 {
+		return d, true
+	}
+	if isAbsentAfter(d) || !indirectValue(d.RightV).IsValid() {
+		return nil, false
+	}
+	right := cloneValue(d.RightV)
+	if err := applyRows(right, children, nil); err != nil {
+		return nil, false
+	}
+	nd := *d
+	nd.RightV = right
+	return &nd, true
+}
+
+func (t *transformer) transform(side int) Patch {
+	other := t.sides[1-side]
+	patch := Patch{differ: t.sides[side].differ, rootType: t.sides[side].rootType}
+	// emit d with indexes shifted, the path of a parent row of the other side has no added index
+	emit := func(d *D, parent bool) {
+		nd := *d
+		row := d
+		if parent {
+			row = nil
+		}
+		if path, ok := t.rewritePath(d.Path, side, row); ok {
+			nd.Path = path
+			patch.add(&nd)
+		}
+	}
+	absorbed := make(map[string]bool)
+	for _, d := range t.sides[side].List {
+		if isLengthRow(d) {
+			if nd, ok := t.lengthRow(d, side); ok {
+				emit(nd, true)
+			}
+			continue
+		}
+		if parent := findParentRow(other, d.Path); parent != nil {
+			// d is merged into the parent row of the other side
+			if !absorbed[parent.Path] {
+				absorbed[parent.Path] = true
+				if nd, ok := t.absorb(parent, 1-side); ok {
+					nd.LeftV = parent.RightV
+					emit(nd, true)
+				}
+			}
+			continue
+		}
+		if d.Reason == DiffOfRightElemAdded || d.Reason == DiffOfLeftElemRemoved {
+			emit(d, false)
+			continue
+		}
+		if od := findRow(other, d.Path); od != nil && od.Reason != DiffOfLeftElemRemoved {
+			if side == 1 {
+				continue
+			}
+			nd := *d
+			nd.LeftV = od.RightV
+			emit(&nd, false)
+			continue
+		}
+		if nd, ok := t.absorb(d, side); ok {
+			d = nd
+		}
+		emit(d, false)
+	}
+	return patch
+}
+
+// lengthRow the length row of side after the other side, lengths are counted by the slice model
+func (t *transformer) lengthRow(d *D, side int) (*D, bool) {
+	if parent := findParentRow(t.sides[1-side], d.Path); parent != nil || findRow(t.sides[1-side], d.Path) != nil {
+		// the container is replaced by the other side
+		return nil, false
+	}
+	m, ok := t.models[d.Path]
+	if !ok || !d.LeftV.IsValid() {
+		return d, true
+	}
+	other := 1 - side
+	removed := len(m.removed[0])
+	for i := range m.removed[1] {
+		if !m.removed[0][i] {
+			removed++
+		}
+	}
+	base := int(d.LeftV.Int())
+	left := base - len(m.removed[other]) + len(m.adds[other])
+	right := base - removed + len(m.adds[0]) + len(m.adds[1])
+	if left == right {
+		return nil, false
+	}
+	nd := *d
+	nd.LeftV, nd.RightV = reflect.ValueOf(left), reflect.ValueOf(right)
+	return &nd, true
+}
+
+func findRow(p *Patch, path string) *D {
+	for _, d := range p.List {
+		if d.Path == path && d.Reason != DiffOfRightElemAdded && !isLengthRow(d) {
+			return d
+		}
+	}
+	return nil
+}
+
+func findParentRow(p *Patch, path string) *D {
+	for _, d := range p.List {
+		if d.Reason != DiffOfRightElemAdded && !isLengthRow(d) && isSubPath(d.Path, path) {
+			return d
+		}
+	}
+	return nil
+}
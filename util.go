@@ -13,16 +13,40 @@ func IsPrimitiveType(tp reflect.Type) bool {
 	return (reflect.Bool <= kind && kind <= reflect.Float64) || kind == reflect.String
 }
 
-func buildPath(steps []string) string {
-	var list []string
+// pathStep is a step of path, the path string is built lazily only when it's needed
+type pathStep struct {
+	// name is field name or map key
+	name string
+	// idx is slice index, -1 for name step
+	idx int
+	// t is the declared type of the path
+	t reflect.Type
+}
+
+func fieldStep(name string, t reflect.Type) pathStep {
+	return pathStep{name: name, idx: -1, t: t}
+}
+
+func indexStep(i int, t reflect.Type) pathStep {
+	return pathStep{idx: i, t: t}
+}
+
+func buildPath(steps []pathStep) string {
+	var b strings.Builder
 	for i, s := range steps {
-		if isIndexToken(s) && i > 0 {
-			list = append(list, s)
+		if s.idx >= 0 {
+			if i == 0 {
+				b.WriteString(_SPLITTOR)
+			}
+			b.WriteString(buildIndexStep(s.idx))
+		} else if isIndexToken(s.name) && i > 0 {
+			b.WriteString(s.name)
 		} else {
-			list = append(list, _SPLITTOR, s)
+			b.WriteString(_SPLITTOR)
+			b.WriteString(s.name)
 		}
 	}
-	return strings.Join(list, "")
+	return b.String()
 }
 
 // is like [number]
@@ -82,8 +106,8 @@ func buildIndexStep(i int) string {
 	return "[" + strconv.FormatInt(int64(i), 10) + "]"
 }
 
-func appendPath(steps []string, tokens ...string) []string {
-	return append(steps, tokens...)
+func appendPath(steps []pathStep, s pathStep) []pathStep {
+	return append(steps, s)
 }
 
 func isExported(fieldName string) bool {
@@ -184,3 +208,51 @@ func LastNodeOfPath(path string) string {
 	steps := strings.Split(path, _SPLITTOR)
 	return steps[len(steps)-1]
 }
+
+// valueOfPath lookup the value of path in v, pointers and interfaces are followed
+func valueOfPath(v reflect.Value, path string) (reflect.Value, bool) {
+	for path != "" {
+		var token string
+		token, path = nextPathToken(path)
+		if token == _SPLITTOR {
+			continue
+		}
+		v = indirectValue(v)
+		if !v.IsValid() {
+			return v, false
+		}
+		switch {
+		case isIndexToken(token) && isListKind(v.Kind()):
+			i, err := strconv.Atoi(token[1 : len(token)-1])
+			if err != nil || i >= v.Len() {
+				return reflect.Value{}, false
+			}
+			v = v.Index(i)
+		case strings.HasPrefix(token, _SPLITTOR) && v.Kind() == reflect.Struct:
+			if v = v.FieldByName(token[1:]); !v.IsValid() {
+				return v, false
+			}
+		case strings.HasPrefix(token, _SPLITTOR) && v.Kind() == reflect.Map:
+			if v = mapIndexByName(v, token[1:]); !v.IsValid() {
+				return v, false
+			}
+		default:
+			return reflect.Value{}, false
+		}
+	}
+	return v, v.IsValid()
+}
+
+// mapIndexByName lookup map value by the path name of key
+func mapIndexByName(mv reflect.Value, name string) reflect.Value {
+	if mv.Type().Key().Kind() == reflect.String {
+		return mv.MapIndex(reflect.ValueOf(name).Convert(mv.Type().Key()))
+	}
+	iter := mv.MapRange()
+	for iter.Next() {
+		if iter.Key().String() == name {
+			return iter.Value()
+		}
+	}
+	return reflect.Value{}
+}